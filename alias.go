@@ -0,0 +1,102 @@
+package ldraw
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// movedTitle title prefix of moved part stub
+const movedTitle = `~Moved to `
+
+// maxAliasDepth longest chain of moved and alias parts followed
+const maxAliasDepth = 16
+
+// IsAlias moved part stub like `~Moved to 3001` or alias part like `=Brick 2 x 4`,
+// which only references another part
+func (h *Header) IsAlias() bool {
+	return strings.HasPrefix(h.Title, movedTitle) || strings.HasPrefix(h.Title, "=") ||
+		strings.HasPrefix(h.Update, "Alias") || strings.HasSuffix(h.Org, "Alias")
+}
+
+// ParseDatAliasFS target part file of moved or alias part in ldraw library fs,
+// empty if file is not an alias
+func ParseDatAliasFS(lib fs.FS, fileName string) (string, error) {
+	oneReader, errF := lib.Open(fileName)
+	if errF != nil {
+		return "", &ParseError{File: fileName, Err: errF}
+	}
+	defer oneReader.Close()
+
+	lines, err := ParseLines(oneReader, fileName)
+	if err != nil {
+		return "", err
+	}
+	return aliasTarget(lines, fileName)
+}
+
+// aliasTarget target part file of alias lines, empty if not an alias
+func aliasTarget(lines []LdrLine, fileName string) (string, error) {
+	if !ParseHeader(lines).IsAlias() {
+		return "", nil
+	}
+
+	for _, one := range lines {
+		if ref, ok := one.(*SubfileRef); ok {
+			return strings.ToLower(strings.ReplaceAll(ref.Name, "\\", "/")), nil
+		}
+	}
+	return "", &ParseError{File: fileName, Err: fmt.Errorf("%w: alias without reference", ErrSubFileNotFound)}
+}
+
+// ResolveAlias current part file of moved or alias part file of built in
+// library, like `3001old.dat`, see LdrInfo.ResolveAlias
+func ResolveAlias(name string) string {
+	return EmbeddedInfo().ResolveAlias(name)
+}
+
+// ResolveAlias current part file of moved or alias part file, like `3001old.dat`,
+// chains are followed. Other names are returned as is. Parts missing in
+// headers of parts list are read from library of parser.
+func (info *LdrInfo) ResolveAlias(name string) string {
+	for i := 0; i < maxAliasDepth; i++ {
+		target, ok := info.Aliases[name]
+		if !ok {
+			target = info.libAlias(name)
+		}
+		if target == "" {
+			break
+		}
+		name = target
+	}
+	return name
+}
+
+// libAlias alias target of part file read from library, empty if part is in
+// headers of parts list or not an alias
+func (info *LdrInfo) libAlias(name string) string {
+	if _, ok := info.Headers[name]; ok {
+		return ""
+	}
+	if got := info.libHeader(name); got != nil {
+		return got.alias
+	}
+	return ""
+}
+
+// addOrigIDs add referenced ids which are resolved to part id
+func (p *Part) addOrigIDs(ids ...string) {
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		i := sort.SearchStrings(p.OrigIDs, id)
+		if i < len(p.OrigIDs) && p.OrigIDs[i] == id {
+			continue
+		}
+		p.OrigIDs = append(p.OrigIDs, "")
+		copy(p.OrigIDs[i+1:], p.OrigIDs[i:])
+		p.OrigIDs[i] = id
+	}
+}
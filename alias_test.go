@@ -0,0 +1,75 @@
+package ldraw
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseDatAliasFS(t *testing.T) {
+	lib := fstest.MapFS{
+		"parts/3001old.dat": {Data: []byte("0 ~Moved to 3001\n0 Name: 3001old.dat\n0 !LDRAW_ORG Part UPDATE 2004-01\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 3001.dat\n")},
+		"parts/3001a.dat":   {Data: []byte("0 =Brick 2 x 4\n0 Name: 3001a.dat\n0 !LDRAW_ORG Part Alias UPDATE 2004-01\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 3001.dat\n")},
+		"parts/3001.dat":    {Data: []byte("0 Brick 2 x 4\n0 Name: 3001.dat\n0 !LDRAW_ORG Part UPDATE 2004-01\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 s\\3001s01.dat\n")},
+	}
+
+	for name, want := range map[string]string{"parts/3001old.dat": "3001.dat", "parts/3001a.dat": "3001.dat", "parts/3001.dat": ""} {
+		got, err := ParseDatAliasFS(lib, name)
+		if err != nil || got != want {
+			t.Errorf("%s: want %q, got %q %v", name, want, got, err)
+		}
+	}
+}
+
+func TestParserResolveAliasLibrary(t *testing.T) {
+	t.Parallel()
+	// parts list without headers and aliases, like gob of older generate
+	parser := NewParser(&LdrInfo{
+		Parts: map[string][2][3]float64{"3001.dat": {}, "3001old.dat": {}, "3001a.dat": {}},
+	}, fstest.MapFS{
+		"parts/3001old.dat": {Data: []byte("0 ~Moved to 3001a\n0 Name: 3001old.dat\n0 !LDRAW_ORG Part UPDATE 2004-01\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 3001a.dat\n")},
+		"parts/3001a.dat":   {Data: []byte("0 =Brick 2 x 4\n0 Name: 3001a.dat\n0 !LDRAW_ORG Part Alias UPDATE 2004-01\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 3001.dat\n")},
+		"parts/3001.dat":    {Data: []byte("0 Brick 2 x 4\n0 Name: 3001.dat\n0 !LDRAW_ORG Part UPDATE 2004-01\n")},
+	})
+
+	for name, want := range map[string]string{"3001old.dat": "3001.dat", "3001a.dat": "3001.dat", "3001.dat": "3001.dat", "3002.dat": "3002.dat"} {
+		if got := parser.info().ResolveAlias(name); got != want {
+			t.Errorf("%s: want %q, got %q", name, want, got)
+		}
+	}
+
+	mainFile := NewRawFile()
+	if err := parser.ParseLdrReader(strings.NewReader("0 Model\n1 4 0 0 0 1 0 0 0 1 0 0 0 1 3001old.dat\n"), "model.ldr", mainFile); err != nil {
+		t.Fatal(err)
+	}
+	if p := mainFile.Parts["3001-4"]; p == nil || strings.Join(p.OrigIDs, ",") != "3001old" {
+		t.Errorf("wrong parts: %v", mainFile.Parts)
+	}
+}
+
+func TestReplaceSubFilesAlias(t *testing.T) {
+	t.Parallel()
+	parser := NewParser(&LdrInfo{
+		Parts:   map[string][2][3]float64{"3001.dat": {}, "3001old.dat": {}, "3001a.dat": {}, "3002old.dat": {}, "3002.dat": {}},
+		Aliases: map[string]string{"3001old.dat": "3001.dat", "3001a.dat": "3001.dat", "3002old.dat": "3002x.dat", "3002x.dat": "3002.dat"},
+	}, nil)
+
+	content := "0 FILE main.ldr\n1 4 0 0 0 1 0 0 0 1 0 0 0 1 3001old.dat\n1 4 0 0 0 1 0 0 0 1 0 0 0 1 sub.ldr\n" +
+		"1 4 0 0 0 1 0 0 0 1 0 0 0 1 3002old.dat\n" +
+		"0 FILE sub.ldr\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 3001A.dat\n1 4 0 0 0 1 0 0 0 1 0 0 0 1 3001.dat\n"
+	mainFile := NewRawFile()
+	if err := parser.ParseLdrReader(strings.NewReader(content), "main.mpd", mainFile); err != nil {
+		t.Fatal(err)
+	}
+
+	got := ReplaceSubFiles(mainFile, &mainFile.SubFiles)
+	if p := got["3001-4"]; p == nil || p.Count != 3 || strings.Join(p.OrigIDs, ",") != "3001a,3001old" {
+		t.Errorf("wrong part: %+v", p)
+	}
+	if p := got["3002-4"]; p == nil || p.Count != 1 || strings.Join(p.OrigIDs, ",") != "3002old" {
+		t.Errorf("wrong chained part: %+v", p)
+	}
+	if len(got) != 2 {
+		t.Errorf("wrong parts: %v", got)
+	}
+}
@@ -1,30 +1,158 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"path"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	ldraw "github.com/zzjin/ldraw_explosion"
 )
 
+var (
+	byStep     = flag.Bool("steps", false, "lay out explosion tray step by step")
+	lddMapping = flag.String("lddmap", "ldraw.xml", "LDD ldraw.xml mapping file for lxf/lxfml")
+	tolerant   = flag.Bool("tolerant", false, "go on with missing or broken parts, placeholder boxes are laid for them")
+	validate   = flag.Bool("validate", false, "only print problems of model, no tray is laid out")
+	jsonOut    = flag.Bool("json", false, "print validate findings as json")
+	bom        = flag.Bool("bom", false, "print parts list with color names of LDConfig.ldr")
+)
+
 func main() {
-	if len(os.Args) < 2 {
+	// exit after deferred calls of run, like report of tolerant mode
+	if code := run(); code != 0 {
+		os.Exit(code)
+	}
+}
+
+// run lay out model of last arg, exit code is returned
+func run() int {
+	flag.Parse()
+	if flag.NArg() < 1 {
 		log.Fatal("Param error,pls drag file on.\nAuthor: zzjin tczzjin#gmail.com\n")
 	}
-	fileName := os.Args[len(os.Args)-1]
+	fileName := flag.Arg(flag.NArg() - 1)
 
-	if path.Ext(fileName) != ".ldr" {
-		log.Fatal("file not supportted, pls drag ldr file on.\nAuthor: zzjin tczzjin#gmail.com\n")
+	// ldraw library of LDRAWDIR, then parts next to model
+	lib, err := ldraw.LibraryFromEnv(filepath.Dir(fileName))
+	if err != nil {
+		log.Fatal(err)
 	}
+	defer lib.Close()
+
+	// parts missing in built in parts list are read from library
+	parser := ldraw.NewParser(nil, lib)
 
 	// parse ldraw file
 	mainFile := ldraw.NewRawFile()
-	ldraw.ParseLdrContent(fileName, mainFile)
+	if *tolerant {
+		mainFile.Report = &ldraw.Report{}
+		defer printReport(mainFile.Report)
+	}
+	switch path.Ext(fileName) {
+	case ".ldr", ".mpd":
+		if err := parser.ParseLdrFile(fileName, mainFile); err != nil {
+			log.Fatal(err)
+		}
+	case ".io":
+		if err := parser.ParseIOFile(fileName, mainFile); err != nil {
+			log.Fatal(err)
+		}
+	case ".lxf", ".lxfml":
+		mapping, err := ldraw.LoadLDDMappingFile(*lddMapping)
+		if err != nil {
+			log.Printf("ldd mapping not loaded, use design id as part: %v\n", err)
+			mapping = ldraw.NewLDDMapping()
+		}
+		if err := parser.ParseLXFFile(fileName, mapping, mainFile); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatal("file not supportted, pls drag ldr/io/lxf file on.\nAuthor: zzjin tczzjin#gmail.com\n")
+	}
+
+	if *validate {
+		if findings := validateModel(mainFile, lib); len(findings) > 0 {
+			return 1
+		}
+		return 0
+	}
+
 	// merge sub inline files into parts
 	allParts := ldraw.ReplaceSubFiles(mainFile, &mainFile.SubFiles)
+	if *bom {
+		printBOM(allParts, mainFile.Colors.Overlay(loadColors(lib)))
+	}
+
+	outName := strings.TrimSuffix(fileName, path.Ext(fileName)) + "_ground.ldr"
+	if *byStep {
+		// parts of each step, sub files expanded in building order
+		parser.StepPackParts(ldraw.StepParts(mainFile, &mainFile.SubFiles), mainFile.Report, mainFile.CustomParts).Save(outName)
+		return 0
+	}
+
+	parser.PackParts(allParts, mainFile.Report, mainFile.CustomParts).Save(outName)
+	return 0
+}
 
-	outName := strings.Replace(fileName, ".ldr", "_ground.ldr", 1)
-	ldraw.NewPackParts(allParts).Save(outName)
+// validateModel print findings of model, as json if asked
+func validateModel(mainFile *ldraw.RawFile, lib *ldraw.Library) []*ldraw.Finding {
+	findings := ldraw.Validate(mainFile, loadColors(lib), lib)
+	if *jsonOut {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(findings); err != nil {
+			log.Fatal(err)
+		}
+		return findings
+	}
+
+	for _, finding := range findings {
+		fmt.Println(finding)
+	}
+	return findings
+}
+
+// loadColors colors of LDConfig.ldr in library, nil if not loaded
+func loadColors(lib *ldraw.Library) *ldraw.ColorTable {
+	colors, err := ldraw.LoadLDConfigFS(lib)
+	if err != nil {
+		log.Printf("colors of %s not loaded: %v\n", ldraw.LDConfigName, err)
+		return nil
+	}
+	return colors
+}
+
+// printBOM print parts list sorted by part id and color, color codes are
+// named by colors
+func printBOM(parts map[string]*ldraw.Part, colors *ldraw.ColorTable) {
+	list := make([]*ldraw.Part, 0, len(parts))
+	for _, part := range parts {
+		list = append(list, part)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].ID != list[j].ID {
+			return list[i].ID < list[j].ID
+		}
+		return list[i].Color < list[j].Color
+	})
+
+	for _, part := range list {
+		fmt.Printf("%4d x %s %s\n", part.Count, part.ID, part.ColorName(colors))
+	}
+}
+
+// printReport print missing and broken parts of tolerant mode
+func printReport(report *ldraw.Report) {
+	for _, problem := range report.Problems() {
+		log.Println(problem)
+	}
+	if report.Len() > 0 {
+		log.Printf("%d problem(s), placeholder boxes are laid for missing parts\n", report.Len())
+	}
 }
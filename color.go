@@ -0,0 +1,247 @@
+package ldraw
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LDConfigName color config file at ldraw root
+const LDConfigName = `LDConfig.ldr`
+
+const (
+	// MainColor main color code, inherit from parent
+	MainColor = 16
+	// EdgeColor edge color code, complement of parent
+	EdgeColor = 24
+)
+
+// Color ldraw color of `0 !COLOUR` line
+type Color struct {
+	Name      string
+	Code      int
+	Value     uint32 // 0xRRGGBB
+	Edge      uint32 // 0xRRGGBB
+	Alpha     int    // 0-255, 255 is opaque
+	Luminance int    // 0-255
+	Material  string // CHROME, PEARLESCENT, RUBBER, MATTE_METALLIC, METAL or MATERIAL, empty for plain
+	// MaterialParams params after MATERIAL, like `GLITTER VALUE #FFFFFF FRACTION 0.17 VFRACTION 0.2 SIZE 1`
+	MaterialParams []string
+}
+
+// RGB RGB of color value
+func (c *Color) RGB() (uint8, uint8, uint8) {
+	return uint8(c.Value >> 16), uint8(c.Value >> 8), uint8(c.Value)
+}
+
+// ColorName name of part color, code if unknown
+func (p *Part) ColorName(ct *ColorTable) string {
+	if c, ok := ct.Lookup(p.Color); ok {
+		return c.Name
+	}
+	return strconv.Itoa(p.Color)
+}
+
+// IsDirect is 0x2RRGGBB or 0x3RRGGBB direct color
+func IsDirect(code int) bool {
+	return code>>24 == 2 || code>>24 == 3
+}
+
+// ColorTable colors by code and by name, local table overlays a parent one
+type ColorTable struct {
+	parent *ColorTable
+	byCode map[int]*Color
+	byName map[string]*Color
+}
+
+// NewColorTable NewColorTable
+func NewColorTable() *ColorTable {
+	return &ColorTable{byCode: map[int]*Color{}, byName: map[string]*Color{}}
+}
+
+// Add add or override color
+func (ct *ColorTable) Add(c *Color) {
+	ct.byCode[c.Code] = c
+	ct.byName[strings.ToLower(c.Name)] = c
+}
+
+// Len count of own colors
+func (ct *ColorTable) Len() int {
+	return len(ct.byCode)
+}
+
+// Overlay new table with own colors overriding base
+func (ct *ColorTable) Overlay(base *ColorTable) *ColorTable {
+	resp := NewColorTable()
+	resp.parent = base
+	for _, c := range ct.byCode {
+		resp.Add(c)
+	}
+	return resp
+}
+
+// Lookup color by code, direct colors are always found
+func (ct *ColorTable) Lookup(code int) (*Color, bool) {
+	for t := ct; t != nil; t = t.parent {
+		if c, ok := t.byCode[code]; ok {
+			return c, true
+		}
+	}
+
+	if IsDirect(code) {
+		c := &Color{
+			Name:  fmt.Sprintf("Direct_0x%X", code),
+			Code:  code,
+			Value: uint32(code & 0xFFFFFF),
+			Edge:  0x333333,
+			Alpha: 255,
+		}
+		if code>>24 == 3 {
+			// transparent direct color
+			c.Alpha = 128
+		}
+		return c, true
+	}
+	return nil, false
+}
+
+// ByName color by case-insensitive name
+func (ct *ColorTable) ByName(name string) (*Color, bool) {
+	name = strings.ToLower(name)
+	for t := ct; t != nil; t = t.parent {
+		if c, ok := t.byName[name]; ok {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// ParseColorMeta parse `0 !COLOUR name CODE x VALUE v EDGE e [ALPHA a] [LUMINANCE l] [material]`,
+// edge given as code is looked up in ct
+func (ct *ColorTable) ParseColorMeta(meta *Meta) (*Color, error) {
+	if meta.Command != "!COLOUR" || len(meta.Args) < 1 {
+		return nil, fmt.Errorf("%w: not a color", ErrBadLine)
+	}
+
+	c := &Color{Name: meta.Args[0], Code: -1, Alpha: 255}
+	hasValue, hasEdge := false, false
+	args := meta.Args[1:]
+	for i := 0; i < len(args); i++ {
+		key := args[i]
+		switch key {
+		case "CHROME", "PEARLESCENT", "RUBBER", "MATTE_METALLIC", "METAL":
+			c.Material = key
+			continue
+		case "MATERIAL":
+			c.Material = key
+			c.MaterialParams = args[i+1:]
+			i = len(args)
+			continue
+		}
+
+		if i+1 >= len(args) {
+			return nil, fmt.Errorf("%w: %s without value", ErrBadLine, key)
+		}
+		value := args[i+1]
+		i++
+
+		var err error
+		switch key {
+		case "CODE":
+			c.Code, err = strconv.Atoi(value)
+		case "VALUE":
+			c.Value, err = parseRGB(value)
+			hasValue = true
+		case "EDGE":
+			if strings.HasPrefix(value, "#") {
+				c.Edge, err = parseRGB(value)
+			} else {
+				// edge given as color code
+				var code int
+				if code, err = parseColorCode(value); err == nil {
+					if edge, ok := ct.Lookup(code); ok {
+						c.Edge = edge.Value
+					}
+				}
+			}
+			hasEdge = true
+		case "ALPHA":
+			c.Alpha, err = strconv.Atoi(value)
+		case "LUMINANCE":
+			c.Luminance, err = strconv.Atoi(value)
+		default:
+			err = fmt.Errorf("unknown key %s", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: color %s: %v", ErrBadLine, c.Name, err)
+		}
+	}
+
+	if c.Code < 0 || !hasValue || !hasEdge {
+		return nil, fmt.Errorf("%w: color %s needs CODE, VALUE and EDGE", ErrBadLine, c.Name)
+	}
+	return c, nil
+}
+
+// parseRGB parse `#RRGGBB` or `0xRRGGBB`
+func parseRGB(s string) (uint32, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(s, "#"), "0x"), "0X")
+	v, err := strconv.ParseUint(s, 16, 32)
+	return uint32(v), err
+}
+
+// addColorLine add color of `0 !COLOUR` line, other lines are ignored
+func (ct *ColorTable) addColorLine(fileName string, one LdrLine) error {
+	meta, ok := one.(*Meta)
+	if !ok || meta.Command != "!COLOUR" {
+		return nil
+	}
+
+	c, err := ct.ParseColorMeta(meta)
+	if err != nil {
+		return &ParseError{File: fileName, Line: meta.Num, Text: meta.Raw, Err: err}
+	}
+	ct.Add(c)
+	return nil
+}
+
+// LoadLDConfig load colors of LDConfig.ldr content
+func LoadLDConfig(r io.Reader, fileName string) (*ColorTable, error) {
+	lines, err := ParseLines(r, fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	ct := NewColorTable()
+	for _, one := range lines {
+		if err := ct.addColorLine(fileName, one); err != nil {
+			return nil, err
+		}
+	}
+	return ct, nil
+}
+
+// LoadLDConfigFile load colors of LDConfig.ldr file
+func LoadLDConfigFile(fileName string) (*ColorTable, error) {
+	oneReader, errF := os.Open(fileName)
+	if errF != nil {
+		return nil, &ParseError{File: fileName, Err: errF}
+	}
+	defer oneReader.Close()
+
+	return LoadLDConfig(oneReader, fileName)
+}
+
+// LoadLDConfigFS load colors of LDConfig.ldr in ldraw library fs
+func LoadLDConfigFS(lib fs.FS) (*ColorTable, error) {
+	oneReader, errF := lib.Open(LDConfigName)
+	if errF != nil {
+		return nil, &ParseError{File: LDConfigName, Err: errF}
+	}
+	defer oneReader.Close()
+
+	return LoadLDConfig(oneReader, LDConfigName)
+}
@@ -0,0 +1,54 @@
+package ldraw
+
+import (
+	"strings"
+	"testing"
+)
+
+const testLDConfig = `0 LDraw.org Configuration File
+0 Name: LDConfig.ldr
+0 !COLOUR Black                                                 CODE   0   VALUE #1B2A34   EDGE #808080
+0 !COLOUR Red                                                   CODE   4   VALUE #C91A09   EDGE #333333
+0 !COLOUR Chrome_Gold                                           CODE 334   VALUE #DFC176   EDGE #C29A36    CHROME
+0 !COLOUR Glitter_Trans_Clear                                   CODE 117   VALUE #FFFFFF   EDGE #C3C3C3   ALPHA 128   MATERIAL GLITTER VALUE #FFFFFF FRACTION 0.08 VFRACTION 0.1 SIZE 1
+0 !COLOUR Main_Colour                                           CODE  16   VALUE #FFFF80   EDGE 0
+`
+
+func TestLoadLDConfig(t *testing.T) {
+	ct, err := LoadLDConfig(strings.NewReader(testLDConfig), LDConfigName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c, ok := ct.Lookup(4); !ok || c.Name != "Red" || c.Value != 0xC91A09 || c.Alpha != 255 {
+		t.Errorf("wrong red: %+v", c)
+	}
+	if c, ok := ct.ByName("chrome_gold"); !ok || c.Code != 334 || c.Material != "CHROME" {
+		t.Errorf("wrong chrome gold: %+v", c)
+	}
+	if c, _ := ct.Lookup(117); c.Alpha != 128 || c.Material != "MATERIAL" || len(c.MaterialParams) != 9 {
+		t.Errorf("wrong glitter: %+v", c)
+	}
+	if c, _ := ct.Lookup(MainColor); c.Edge != 0x1B2A34 {
+		t.Errorf("edge by code not resolved: %+v", c)
+	}
+	if c, ok := ct.Lookup(0x2FF8000); !ok || c.Value != 0xFF8000 {
+		t.Errorf("wrong direct color: %+v", c)
+	}
+	if _, ok := ct.Lookup(999); ok {
+		t.Error("unknown color found")
+	}
+
+	content := "0 model\n0 !COLOUR My_Red CODE 4 VALUE #FF0000 EDGE #333333\n1 4 0 0 0 1 0 0 0 1 0 0 0 1 mybrick.dat\n"
+	mainFile := NewRawFile()
+	if err := ParseLdrReader(strings.NewReader(content), "model.ldr", mainFile); err != nil {
+		t.Fatal(err)
+	}
+	local := mainFile.Colors.Overlay(ct)
+	if name := mainFile.Parts["mybrick.dat-4"].ColorName(local); name != "My_Red" {
+		t.Errorf("local color not used: %s", name)
+	}
+	if c, ok := local.Lookup(0); !ok || c.Name != "Black" {
+		t.Errorf("base color not found: %+v", c)
+	}
+}
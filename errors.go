@@ -0,0 +1,36 @@
+package ldraw
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrSubFileNotFound sub file not in any ldraw location
+	ErrSubFileNotFound = errors.New("sub file not found")
+	// ErrBadLine line can not be parsed
+	ErrBadLine = errors.New("wrong line")
+	// ErrBadMatrix matrix values not match
+	ErrBadMatrix = errors.New("matrix not match")
+	// ErrRecursive sub file references itself
+	ErrRecursive = errors.New("recursive sub file")
+)
+
+// ParseError error with the file, line number and offending text
+type ParseError struct {
+	File string
+	Line int    // 0 if not line related
+	Text string // offending line text
+	Err  error  // cause
+}
+
+func (e *ParseError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("file %s: %v", e.File, e.Err)
+	}
+	return fmt.Sprintf("file %s line %d: %q: %v", e.File, e.Line, e.Text, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,79 @@
+package ldraw
+
+// Instance one part placed in assembled model
+type Instance struct {
+	ID     string       // part id, like Part.ID
+	OrigID string       // referenced moved or alias part id, empty if same as ID
+	Color  int          // color with 16 and 24 of sub files resolved
+	Matrix *TransMatrix // world transform of part
+	Path   []string     // names of files from main file down to the one placing part
+	Ref    *SubfileRef  // line placing part
+	Flex   *FlexInfo    // flexible part of LDCad generated sub file
+}
+
+// Flatten all parts of file with world transforms, inline sub files are
+// walked in file order. Parts placed in model are followed, also LPub PLI
+// ignored ones, but not PLI substitutes or copies hidden by BUFEXCHG. Edge
+// color 24 of sub file parts is resolved by edge of parent color in colors,
+// which can be nil.
+func Flatten(rawFile *RawFile, subFiles *map[string]*RawFile, colors *ColorTable) []*Instance {
+	resp := []*Instance{}
+	flattenFile(rawFile, subFiles, colors, InitMatrix, MainColor, []string{rawFile.Name}, &resp)
+	return resp
+}
+
+func flattenFile(rawFile *RawFile, subFiles *map[string]*RawFile, colors *ColorTable, matrix *TransMatrix, color int, filePath []string, resp *[]*Instance) {
+	for _, line := range rawFile.Lines {
+		ref, ok := line.(*SubfileRef)
+		if !ok || ref.Hidden {
+			continue
+		}
+		id, orig, ok := rawFile.partInfo().refPartID(ref)
+		if !ok {
+			continue
+		}
+
+		if inPath(filePath, id) {
+			// file placing itself or its parent
+			continue
+		}
+
+		world := MultipleMatrix(matrix, ref.TransMatrix())
+		refColor := inheritColor(ref.Color, color, colors)
+
+		sub, isSub := (*subFiles)[id]
+		if isSub && sub.Flex == nil {
+			subPath := append(append([]string{}, filePath...), sub.Name)
+			flattenFile(sub, subFiles, colors, world, refColor, subPath, resp)
+			continue
+		}
+
+		one := &Instance{ID: id, OrigID: orig, Color: refColor, Matrix: world, Path: filePath, Ref: ref}
+		if isSub {
+			one.Flex = sub.Flex
+		}
+		*resp = append(*resp, one)
+	}
+}
+
+// inheritColor color of line in sub file placed with parent color
+func inheritColor(code, parent int, colors *ColorTable) int {
+	switch {
+	case code == MainColor:
+		return parent
+	case code == EdgeColor && parent != MainColor && parent != EdgeColor:
+		if c, ok := colors.Lookup(parent); ok {
+			return 0x2000000 | int(c.Edge)
+		}
+	}
+	return code
+}
+
+func inPath(filePath []string, name string) bool {
+	for _, one := range filePath {
+		if one == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package ldraw
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFlatten(t *testing.T) {
+	content := "0 FILE main.ldr\n1 4 0 0 100 0 0 1 0 1 0 -1 0 0 sub.ldr\n1 1 0 -24 0 1 0 0 0 1 0 0 0 1 mybrick.dat\n" +
+		"0 FILE sub.ldr\n1 16 10 0 0 1 0 0 0 1 0 0 0 1 inner.ldr\n1 24 0 0 0 1 0 0 0 1 0 0 0 1 edge.dat\n" +
+		"0 FILE inner.ldr\n1 16 0 0 5 1 0 0 0 1 0 0 0 1 mybrick.dat\n1 14 0 0 0 1 0 0 0 1 0 0 0 1 main.ldr\n"
+	mainFile := NewRawFile()
+	if err := ParseLdrReader(strings.NewReader(content), "main.mpd", mainFile); err != nil {
+		t.Fatal(err)
+	}
+
+	colors := NewColorTable()
+	colors.Add(&Color{Name: "Red", Code: 4, Value: 0xC91A09, Edge: 0x333333})
+	got := Flatten(mainFile, &mainFile.SubFiles, colors)
+	if len(got) != 3 {
+		t.Fatalf("want 3 instances, got %d", len(got))
+	}
+
+	// sub.ldr turned 90 degree around y, inner.ldr moved along x in sub.ldr
+	brick := got[0]
+	if brick.ID != "mybrick.dat" || brick.Color != 4 || strings.Join(brick.Path, "/") != "main.ldr/sub.ldr/inner.ldr" {
+		t.Errorf("wrong instance: %+v", brick)
+	}
+	if pos := (TransVector{brick.Matrix[12], brick.Matrix[13], brick.Matrix[14]}); pos != (TransVector{5, 0, 90}) {
+		t.Errorf("wrong position: %v", pos)
+	}
+	if brick.Matrix[2] != -1 || brick.Matrix[8] != 1 {
+		t.Errorf("wrong rotation: %v", brick.Matrix)
+	}
+
+	if edge := got[1]; edge.ID != "edge.dat" || edge.Color != 0x2333333 {
+		t.Errorf("wrong edge color: %+v", edge)
+	}
+	if top := got[2]; top.Color != 1 || len(top.Path) != 1 || top.Matrix[13] != -24 {
+		t.Errorf("wrong top part: %+v", top)
+	}
+}
+
+func TestFlattenMetaBlocks(t *testing.T) {
+	content := "0 Model\n" +
+		"0 !LPUB PLI BEGIN IGN\n1 1 0 0 0 1 0 0 0 1 0 0 0 1 ign.dat\n0 !LPUB PLI END\n" +
+		"0 !LPUB PLI BEGIN SUB mysub.dat\n1 2 0 0 0 1 0 0 0 1 0 0 0 1 real.dat\n0 !LPUB PLI END\n" +
+		"0 BUFEXCHG A STORE\n1 14 0 0 0 1 0 0 0 1 0 0 0 1 copy.dat\n0 BUFEXCHG A RETRIEVE\n"
+	mainFile := NewRawFile()
+	if err := ParseLdrReader(strings.NewReader(content), "model.ldr", mainFile); err != nil {
+		t.Fatal(err)
+	}
+
+	// parts in model, whatever is in parts list
+	got := Flatten(mainFile, &mainFile.SubFiles, nil)
+	if len(got) != 2 || got[0].ID != "ign.dat" || got[1].ID != "real.dat" {
+		t.Errorf("wrong instances: %v", got)
+	}
+}
@@ -0,0 +1,119 @@
+package ldraw
+
+import (
+	"math"
+	"path"
+	"strings"
+)
+
+// FlexInfo LDCad generated flexible part, like hose, cable or band
+type FlexInfo struct {
+	Part      string      // part id in parts list, generated file name without extension
+	Type      string      // `!LDCAD CONTENT` type, like path or springShortcut
+	Generator string      // `!LDCAD GENERATED` generator
+	Segment   string      // most used part file of generated segments
+	Segments  int         // count of generated segments
+	Length    float64     // LDU along generated segments
+	Axis      TransVector // segment local direction along the path
+}
+
+// detectFlex detect LDCad `!LDCAD CONTENT`/`!LDCAD PATH_*` file with
+// `!LDCAD GENERATED` segments, nil for other files. Header of rf is parsed.
+func detectFlex(rf *RawFile) *FlexInfo {
+	// LDCad names generated file after part of template, like 32580.ldr
+	name := rf.Name
+	if rf.Header != nil && rf.Header.Name != "" {
+		name = strings.ToLower(rf.Header.Name)
+	}
+	flex := &FlexInfo{Part: strings.TrimSuffix(name, path.Ext(name))}
+	isPath, isGenerated := false, false
+	refs := []*SubfileRef{}
+
+	for _, one := range rf.Lines {
+		if meta, ok := one.(*Meta); ok && meta.Command == "!LDCAD" && len(meta.Args) > 0 {
+			params := ldcadParams(restFields(meta.Text, 2))
+			switch {
+			case meta.Args[0] == "CONTENT":
+				flex.Type = params["type"]
+				isPath = true
+			case strings.HasPrefix(meta.Args[0], "PATH_"):
+				isPath = true
+			case meta.Args[0] == "GENERATED":
+				flex.Generator = params["generator"]
+				isGenerated = true
+			}
+			continue
+		}
+
+		if ref, ok := one.(*SubfileRef); ok && isGenerated {
+			refs = append(refs, ref)
+		}
+	}
+	if !isPath || !isGenerated || len(refs) == 0 {
+		return nil
+	}
+
+	// most used part is the segment, others are like end caps
+	counts := map[string]int{}
+	for _, ref := range refs {
+		counts[strings.ToLower(ref.Name)]++
+	}
+	for name, count := range counts {
+		if count > flex.Segments || (count == flex.Segments && name < flex.Segment) {
+			flex.Segment, flex.Segments = name, count
+		}
+	}
+
+	segments := []*SubfileRef{}
+	for _, ref := range refs {
+		if strings.ToLower(ref.Name) == flex.Segment {
+			segments = append(segments, ref)
+		}
+	}
+
+	// length along segments, each segment holds one gap
+	for i := 1; i < len(segments); i++ {
+		flex.Length += vectorDistance(segments[i-1].Pos, segments[i].Pos)
+	}
+	if len(segments) > 1 {
+		flex.Length += flex.Length / float64(len(segments)-1)
+	}
+
+	flex.Axis = TransVector{0, 1, 0}
+	if len(segments) > 1 {
+		// path direction in first segment space: R^T * (p1 - p0)
+		m := segments[0].Matrix
+		d := TransVector{segments[1].Pos[0] - segments[0].Pos[0], segments[1].Pos[1] - segments[0].Pos[1], segments[1].Pos[2] - segments[0].Pos[2]}
+		axis := TransVector{
+			m[0]*d[0] + m[3]*d[1] + m[6]*d[2],
+			m[1]*d[0] + m[4]*d[1] + m[7]*d[2],
+			m[2]*d[0] + m[5]*d[1] + m[8]*d[2],
+		}
+		if l := vectorDistance(axis, TransVector{}); l > 0 {
+			flex.Axis = TransVector{axis[0] / l, axis[1] / l, axis[2] / l}
+		}
+	}
+	return flex
+}
+
+// ldcadParams parse `[key=value] [key="some value"]` params of LDCad meta
+func ldcadParams(text string) map[string]string {
+	resp := map[string]string{}
+	for {
+		start := strings.IndexByte(text, '[')
+		end := strings.IndexByte(text, ']')
+		if start < 0 || end < start {
+			return resp
+		}
+
+		kv := strings.SplitN(text[start+1:end], "=", 2)
+		if len(kv) == 2 {
+			resp[strings.TrimSpace(kv[0])] = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+		}
+		text = text[end+1:]
+	}
+}
+
+func vectorDistance(a, b TransVector) float64 {
+	return math.Sqrt((a[0]-b[0])*(a[0]-b[0]) + (a[1]-b[1])*(a[1]-b[1]) + (a[2]-b[2])*(a[2]-b[2]))
+}
@@ -0,0 +1,52 @@
+package ldraw
+
+import (
+	"bytes"
+	"io/fs"
+	"path"
+	"time"
+)
+
+// overlayFS search files in each fs in order
+type overlayFS []fs.FS
+
+func (ofs overlayFS) Open(name string) (fs.File, error) {
+	for _, one := range ofs {
+		if one == nil {
+			continue
+		}
+		if f, err := one.Open(name); err == nil {
+			return f, nil
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// memFS in memory read only fs of files, directories are not listed
+type memFS map[string][]byte
+
+func (mfs memFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	data, ok := mfs[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &memFile{Reader: bytes.NewReader(data), name: name, size: int64(len(data))}, nil
+}
+
+type memFile struct {
+	*bytes.Reader
+	name string
+	size int64
+}
+
+func (mf *memFile) Stat() (fs.FileInfo, error) { return mf, nil }
+func (mf *memFile) Close() error               { return nil }
+func (mf *memFile) Name() string               { return path.Base(mf.name) }
+func (mf *memFile) Size() int64                { return mf.size }
+func (mf *memFile) Mode() fs.FileMode          { return 0o444 }
+func (mf *memFile) ModTime() time.Time         { return time.Time{} }
+func (mf *memFile) IsDir() bool                { return false }
+func (mf *memFile) Sys() interface{}           { return nil }
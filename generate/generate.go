@@ -4,108 +4,65 @@
 package main
 
 import (
+	"context"
 	_ "embed"
 	"encoding/gob"
+	"flag"
 	"log"
 	"os"
-	"path/filepath"
-	"runtime"
-	"strings"
-	"sync"
+	"os/signal"
 
 	ldraw "github.com/zzjin/ldraw_explosion"
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		log.Fatal("Param error,pls spec ldraw dir.\nAuthor: zzjin tczzjin#gmail.com\n")
+	exact := flag.Bool("exact", false, "exact bounding boxes of rotated sub files, slower")
+	tolerant := flag.Bool("tolerant", false, "size broken parts without their missing sub files instead of failing")
+	flag.Parse()
+	if flag.NArg() < 1 {
+		log.Fatal("Param error,pls spec ldraw dir or complete.zip.\nAuthor: zzjin tczzjin#gmail.com\n")
 	}
 
-	ldrawRoot := os.Args[len(os.Args)-1]
-	if ldrawRoot[len(ldrawRoot)-1:] != "/" {
-		ldrawRoot += "/"
-	}
-
-	pFiles := walkDatDir(ldrawRoot, ldraw.PLocation, false)
-	partFiles := walkDatDir(ldrawRoot, ldraw.PartsLocation, true)
-
-	log.Printf("p:%d,part:%d\n", len(pFiles), len(partFiles))
-
-	f, err := os.Create("ldraw_aio.gob")
+	// ldraw dirs or zips, like `complete.zip ldrawunf.zip`, first one wins
+	lib, err := ldraw.NewLibraryPaths(flag.Args()...)
 	if err != nil {
-		log.Fatalf("Couldn't open file: %v", err)
+		log.Fatal(err)
 	}
-	defer f.Close()
+	defer lib.Close()
 
-	pGob := map[string]struct{}{}
-	for k := range pFiles {
-		pGob[k] = struct{}{}
-	}
-	partsGob := map[string][2][3]float64{}
-	for k, v := range partFiles {
-		partsGob[k] = v.ToGob()
-	}
+	// ctrl-c stops generation cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	filesAIO := &ldraw.LdrInfo{P: pGob, Parts: partsGob}
-	if err := gob.NewEncoder(f).Encode(filesAIO); err != nil {
-		log.Fatalf("Write failed: %v", err)
+	// tolerant mode if set, broken parts are sized without missing sub files
+	var report *ldraw.Report
+	if *tolerant {
+		report = &ldraw.Report{}
 	}
-}
-
-var (
-	l       sync.Mutex
-	wg      sync.WaitGroup
-	numCPUs = runtime.NumCPU()
-)
-
-func walkDatDir(ldrawRoot, entryPath string, parseBounding bool) map[string]*ldraw.BoundingBox {
-	walkPath := ldrawRoot + entryPath
-	ch := make(chan string)
-
-	files := map[string]*ldraw.BoundingBox{}
-	worker := func(ch chan string) {
-		for path := range ch {
-			relaPath := strings.ToLower(strings.TrimPrefix(path, walkPath)) // cast all to lower case
 
-			boundingBox := &ldraw.BoundingBox{}
-			if parseBounding {
-				log.Printf("parse: %s\n", strings.ReplaceAll(path, ldrawRoot, ""))
-				boundingBox = ldraw.ParseDatFile(path, ldraw.InitMatrix, ldrawRoot)
-			}
+	// parser shares parsed primitives between all parts
+	parser := ldraw.NewParser(&ldraw.LdrInfo{}, lib)
+	parser.Exact = *exact
+	filesAIO, err := parser.LibraryInfo(ctx, report)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-			l.Lock()
-			files[relaPath] = boundingBox
-			l.Unlock()
+	log.Printf("p:%d,part:%d\n", len(filesAIO.P), len(filesAIO.Parts))
+	if report != nil {
+		for _, problem := range report.Problems() {
+			log.Println(problem)
 		}
-
-		wg.Done()
+		log.Printf("%d problem(s), broken parts are sized without missing sub files\n", report.Len())
 	}
 
-	// start the workers
-	for t := 0; t < numCPUs; t++ {
-		wg.Add(1)
-		go worker(ch)
+	f, err := os.Create("ldraw_aio.gob")
+	if err != nil {
+		log.Fatalf("Couldn't open file: %v", err)
 	}
+	defer f.Close()
 
-	if wErr := filepath.WalkDir(walkPath, func(path string, _ os.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if filepath.Ext(path) == ".dat" {
-			if strings.Contains(path, "/textures/") || strings.Contains(path, "/s/") {
-				return nil
-			}
-
-			ch <- path
-		}
-		return nil
-	}); wErr != nil {
-		log.Fatal(wErr)
+	if err := gob.NewEncoder(f).Encode(filesAIO); err != nil {
+		log.Fatalf("Write failed: %v", err)
 	}
-
-	close(ch)
-	wg.Wait()
-
-	return files
 }
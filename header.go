@@ -0,0 +1,151 @@
+package ldraw
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// Header standard ldraw file header
+type Header struct {
+	Title    string // description, first line
+	Name     string // `0 Name:`
+	Author   string // `0 Author:`
+	Org      string // `0 !LDRAW_ORG` type, like Part, Subpart, Unofficial_Part
+	Update   string // `0 !LDRAW_ORG` update tag, like `UPDATE 2004-01` or `ORIGINAL`
+	License  string // `0 !LICENSE`
+	Category string // `0 !CATEGORY`, or first word of part title
+	BFC      string // first `0 BFC`, like `CERTIFY CCW`
+	Keywords []string
+	History  []string
+}
+
+// ParseHeader parse header meta commands before first none type 0 line,
+// `0 FILE` line of mpd is skipped
+func ParseHeader(lines []LdrLine) *Header {
+	h := &Header{}
+	hasTitle := false
+
+	for _, one := range lines {
+		if one.LineType() < 0 {
+			continue
+		}
+		if one.LineType() != 0 {
+			break
+		}
+		meta, ok := one.(*Meta)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case meta.Command == "FILE":
+			continue
+		case strings.HasPrefix(meta.Text, "Name:"):
+			h.Name = strings.TrimSpace(strings.TrimPrefix(meta.Text, "Name:"))
+		case strings.HasPrefix(meta.Text, "Author:"):
+			h.Author = strings.TrimSpace(strings.TrimPrefix(meta.Text, "Author:"))
+		case meta.Command == "!LDRAW_ORG":
+			if len(meta.Args) > 0 {
+				h.Org = meta.Args[0]
+				h.Update = strings.Join(meta.Args[1:], " ")
+			}
+		case meta.Command == "!LICENSE":
+			h.License = restFields(meta.Text, 1)
+		case meta.Command == "!CATEGORY":
+			h.Category = restFields(meta.Text, 1)
+		case meta.Command == "!KEYWORDS":
+			for _, k := range strings.Split(restFields(meta.Text, 1), ",") {
+				if k = strings.TrimSpace(k); k != "" {
+					h.Keywords = append(h.Keywords, k)
+				}
+			}
+		case meta.Command == "!HISTORY":
+			h.History = append(h.History, restFields(meta.Text, 1))
+		case meta.Command == "BFC":
+			if h.BFC == "" {
+				h.BFC = restFields(meta.Text, 1)
+			}
+		case !hasTitle:
+			// first other line, `0 Name:` may come before it
+			h.Title = meta.Text
+			hasTitle = true
+		}
+	}
+
+	if h.Category == "" && strings.Contains(h.Org, "Part") {
+		// part category default to first word of title
+		if fields := strings.Fields(strings.TrimLeft(h.Title, "~=_|")); len(fields) > 0 {
+			h.Category = fields[0]
+		}
+	}
+	return h
+}
+
+// ParseDatHeader parse header of ldraw library file
+func ParseDatHeader(fileName string) (*Header, error) {
+	oneReader, errF := os.Open(fileName)
+	if errF != nil {
+		return nil, &ParseError{File: fileName, Err: errF}
+	}
+	defer oneReader.Close()
+
+	return parseDatHeaderReader(oneReader, fileName)
+}
+
+// ParseDatHeaderFS parse header of file in ldraw library fs
+func ParseDatHeaderFS(lib fs.FS, fileName string) (*Header, error) {
+	oneReader, errF := lib.Open(fileName)
+	if errF != nil {
+		return nil, &ParseError{File: fileName, Err: errF}
+	}
+	defer oneReader.Close()
+
+	return parseDatHeaderReader(oneReader, fileName)
+}
+
+// Header header of library part file, like `3001.dat`, from Headers or read
+// from library of parser if missing there
+func (info *LdrInfo) Header(name string) (*Header, bool) {
+	name = strings.ToLower(name)
+	if h, ok := info.Headers[name]; ok {
+		return h, true
+	}
+	if got := info.libHeader(name); got != nil {
+		return got.header, true
+	}
+	return nil, false
+}
+
+// libHeader header and alias target of part file read from library, once
+// per file. Nil if there is no library or file is not in it.
+func (info *LdrInfo) libHeader(name string) *libHeader {
+	if info.lib == nil {
+		return nil
+	}
+	if got, ok := info.fromLib.Load(name); ok {
+		return got.(*libHeader)
+	}
+
+	var got *libHeader
+	if location, err := findSubFileFS(info.lib, name); err == nil {
+		if oneReader, err := info.lib.Open(location); err == nil {
+			if lines, err := ParseLines(oneReader, location); err == nil {
+				got = &libHeader{header: ParseHeader(lines)}
+				got.alias, _ = aliasTarget(lines, location)
+			}
+			oneReader.Close()
+		}
+	}
+	info.fromLib.Store(name, got)
+	return got
+}
+
+func parseDatHeaderReader(r io.Reader, fileName string) (*Header, error) {
+	lines, err := ParseLines(r, fileName)
+	if err != nil {
+		return nil, err
+	}
+	return ParseHeader(lines), nil
+}
@@ -1,13 +1,13 @@
 package ldraw
 
 import (
-	"bytes"
-	_ "embed"
-	"encoding/gob"
+	"fmt"
+	"io/fs"
 	"log"
-	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 //go:generate go run ./generate/generate.go /home/zzjin/projects/lego/ldraw/
@@ -34,55 +34,105 @@ var (
 	}
 )
 
-// getSubFileRealLocation getSubFileRealLocation
+// getSubFileRealLocation getSubFileRealLocation, fatal if not found
 func getSubFileRealLocation(filePath, ldrawRoot string) string {
+	cp, err := findSubFileRealLocation(filePath, ldrawRoot)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return cp
+}
+
+// findSubFileRealLocation find sub file in offical and unoffical ldraw dirs
+func findSubFileRealLocation(filePath, ldrawRoot string) (string, error) {
+	lib := rootParser(ldrawRoot).Library.(*Library)
+	cp, err := lib.Find(filePath)
+	if err != nil {
+		return "", err
+	}
+	_, real, _ := lib.resolve(cp)
+	return filepath.Join(ldrawRoot, filepath.FromSlash(real)), nil
+}
+
+// findSubFileFS find sub file in offical and unoffical dirs of ldraw library fs,
+// *Library is searched case-insensitively
+func findSubFileFS(lib fs.FS, filePath string) (string, error) {
+	if l, ok := lib.(*Library); ok {
+		return l.Find(filePath)
+	}
+
 	filePath = strings.Replace(filePath, "\\", "/", -1)
 
 	for _, p := range pLocations {
-		cp := filepath.Clean(ldrawRoot + p + filePath)
-		if _, err := os.Stat(cp); err == nil {
-			return cp
+		cp := path.Clean(p + filePath)
+		if _, err := fs.Stat(lib, cp); err == nil {
+			return cp, nil
 		}
 	}
 
 	// Additional check UnOfficial dir path
-	unOfficialRoot := ldrawRoot + UnOfficialLocation
 	for _, p := range pLocations {
-		cp := filepath.Clean(unOfficialRoot + p + filePath)
-		if _, err := os.Stat(cp); err == nil {
-			return cp
+		cp := path.Clean(UnOfficialLocation + p + filePath)
+		if _, err := fs.Stat(lib, cp); err == nil {
+			return cp, nil
 		}
 	}
 
-	log.Fatalf("sub file not found: %s\n", filePath)
-	return ""
+	return "", fmt.Errorf("%w: %s", ErrSubFileNotFound, filePath)
 }
 
 // LdrInfo Ldr Full Info
 type LdrInfo struct {
-	P     map[string]struct{}
-	Parts map[string][2][3]float64
-}
+	P       map[string]struct{}
+	Parts   map[string][2][3]float64
+	Headers map[string]*Header // headers of Parts
+	Aliases map[string]string  // moved and alias parts -> referenced part, like Parts keys
 
-//go:embed ldraw_aio.gob
-var ldrawAIOGob []byte
+	lib     fs.FS    // library of parser, read for parts missing in Headers
+	fromLib sync.Map // part file -> *libHeader read from lib
+}
 
-var AllP, AllParts = func() (map[string]struct{}, map[string][2][3]float64) {
-	got := &LdrInfo{}
-	gob.NewDecoder(bytes.NewBuffer(ldrawAIOGob)).Decode(&got)
-	return got.P, got.Parts
-}()
+// libHeader header of part read from library, alias is target part if any
+type libHeader struct {
+	header *Header
+	alias  string
+}
 
 // RawFile RawFile
 type RawFile struct {
 	Name     string
 	Parts    map[string]*Part
 	SubFiles map[string]*RawFile
+	Lines    []LdrLine // all lines in order
+
+	DataFiles    map[string]*DataFile // embedded `0 !DATA` files
+	SubFileOrder []string             // SubFiles and DataFiles names in file order
+
+	Steps  []*Step // building steps
+	Header *Header
+	Colors *ColorTable // local `0 !COLOUR` definitions
+
+	CustomParts map[string][2][3]float64 // bounding boxes of custom parts, like LdrInfo.Parts
+	Flex        *FlexInfo                // LDCad generated flexible part of sub file, nil for others
+
+	Report *Report // tolerant mode if set, missing and broken parts are recorded here
+
+	info *LdrInfo // parts list of parser, EmbeddedInfo if nil
 }
 
 // NewRawFile NewRawFile
 func NewRawFile() *RawFile {
-	return &RawFile{Name: "", Parts: map[string]*Part{}, SubFiles: map[string]*RawFile{}}
+	return &RawFile{
+		Name: "", Parts: map[string]*Part{}, SubFiles: map[string]*RawFile{}, DataFiles: map[string]*DataFile{},
+		Colors: NewColorTable(), CustomParts: map[string][2][3]float64{},
+	}
+}
+
+// DataFile embedded `0 !DATA` file of mpd
+type DataFile struct {
+	Name    string
+	Content []byte // decoded content
+	Lines   []LdrLine
 }
 
 // Part Part
@@ -90,4 +140,7 @@ type Part struct {
 	ID    string
 	Color int
 	Count int
+	Flex  *FlexInfo // flexible part of LDCad generated sub file
+
+	OrigIDs []string // referenced moved or alias part ids resolved to ID, sorted
 }
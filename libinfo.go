@@ -0,0 +1,123 @@
+package ldraw
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// LibraryInfo parts list of library of parser, like EmbeddedInfo: p files,
+// bounding boxes of parts with their headers and moved or alias targets.
+// Parts are parsed by Workers at once, each sub file once. Tolerant mode if
+// report is set, broken parts are sized without missing sub files. Parsing
+// stops with ctx error once ctx is done.
+func (p *Parser) LibraryInfo(ctx context.Context, report *Report) (*LdrInfo, error) {
+	if p.Library == nil {
+		return nil, &ParseError{File: PartsLocation, Err: fs.ErrNotExist}
+	}
+	lib, ok := p.Library.(*Library)
+	if !ok {
+		lib = NewLibrary(p.Library)
+	}
+
+	info := &LdrInfo{
+		P: map[string]struct{}{}, Parts: map[string][2][3]float64{},
+		Headers: map[string]*Header{}, Aliases: map[string]string{},
+	}
+	for _, name := range libraryDatFiles(lib, PLocation) {
+		info.P[strings.TrimPrefix(name, PLocation)] = struct{}{}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		l        sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+	)
+	ch := make(chan string)
+	workers := p.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range ch {
+				bb, header, alias, err := p.libraryPart(ctx, name, report)
+
+				l.Lock()
+				if err != nil && firstErr == nil {
+					// strict mode, left files are drained
+					firstErr = err
+					cancel()
+				}
+				if err == nil {
+					// library paths are lower case
+					partName := strings.TrimPrefix(name, PartsLocation)
+					info.Parts[partName] = bb.ToGob()
+					info.Headers[partName] = header
+					if alias != "" {
+						info.Aliases[partName] = alias
+					}
+				}
+				l.Unlock()
+			}
+		}()
+	}
+
+	for _, name := range libraryDatFiles(lib, PartsLocation) {
+		if ctx.Err() != nil {
+			break
+		}
+		ch <- name
+	}
+	close(ch)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// libraryPart bounding box, header and alias target of part file, file is
+// read once for all of them
+func (p *Parser) libraryPart(ctx context.Context, name string, report *Report) (*BoundingBox, *Header, string, error) {
+	own := report.child()
+	lines, err := p.readLibraryDat(ctx, name, own)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	bb, err := p.parseDatLines(ctx, lines, name, InitMatrix, own, topCall(name))
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	alias, err := aliasTarget(lines, name)
+	if err := report.tolerate(ProblemBroken, strings.TrimPrefix(name, PartsLocation), err); err != nil {
+		return nil, nil, "", err
+	}
+	return bb, ParseHeader(lines), alias, nil
+}
+
+// libraryDatFiles dat files in dir of library, sub parts and textures are
+// left out
+func libraryDatFiles(lib *Library, dir string) []string {
+	resp := []string{}
+	for _, name := range lib.Files(dir) {
+		if path.Ext(name) != ".dat" || strings.Contains(name, "/textures/") || strings.Contains(name, "/s/") {
+			continue
+		}
+		resp = append(resp, name)
+	}
+	return resp
+}
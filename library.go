@@ -0,0 +1,189 @@
+package ldraw
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// LDrawDirEnv environment variable of ldraw library dir
+const LDrawDirEnv = "LDRAWDIR"
+
+// LDrawZipLocation library dir inside official complete.zip
+const LDrawZipLocation = `ldraw/`
+
+// Library ldraw parts library of one or more roots, searched in order.
+// In each root official dirs are searched first, then UnOfficial/ dirs and
+// then root itself, so a root can be a full library or a flat dir of parts.
+// Names are matched case-insensitively, each root is indexed once on first use.
+type Library struct {
+	roots   []fs.FS
+	closers []io.Closer // opened zip archives
+
+	once  sync.Once
+	index []map[string]string // per root: lower case path -> real path
+}
+
+// NewLibrary library of roots, first root has highest precedence
+func NewLibrary(roots ...fs.FS) *Library {
+	return &Library{roots: roots}
+}
+
+// NewLibraryDirs library of dirs, first dir has highest precedence
+func NewLibraryDirs(dirs ...string) *Library {
+	roots := []fs.FS{}
+	for _, dir := range dirs {
+		if dir != "" {
+			roots = append(roots, os.DirFS(dir))
+		}
+	}
+	return NewLibrary(roots...)
+}
+
+// NewLibraryPaths library of dirs and zip archives like complete.zip or
+// ldrawunf.zip, first one has highest precedence. Close it to close archives.
+func NewLibraryPaths(paths ...string) (*Library, error) {
+	lib := NewLibrary()
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		if strings.ToLower(filepath.Ext(p)) != ".zip" {
+			lib.roots = append(lib.roots, os.DirFS(p))
+			continue
+		}
+
+		zr, err := zip.OpenReader(p)
+		if err != nil {
+			lib.Close()
+			return nil, err
+		}
+		lib.closers = append(lib.closers, zr)
+
+		// complete.zip has all files in `ldraw/`, ldrawunf.zip in root
+		var root fs.FS = zr
+		name := strings.TrimSuffix(LDrawZipLocation, "/")
+		if info, err := fs.Stat(zr, name); err == nil && info.IsDir() {
+			root, _ = fs.Sub(zr, name)
+		}
+		lib.roots = append(lib.roots, root)
+	}
+	return lib, nil
+}
+
+// LibraryFromEnv library of LDRAWDIR, then extra dirs or zip archives in
+// order like model dir, unofficial or personal parts dirs
+func LibraryFromEnv(extraPaths ...string) (*Library, error) {
+	return NewLibraryPaths(append([]string{os.Getenv(LDrawDirEnv)}, extraPaths...)...)
+}
+
+// Close close zip archives of library
+func (lib *Library) Close() error {
+	var resp error
+	for _, c := range lib.closers {
+		if err := c.Close(); err != nil && resp == nil {
+			resp = err
+		}
+	}
+	lib.closers = nil
+	return resp
+}
+
+// libraryLocations search dirs of each root, in order
+var libraryLocations = func() []string {
+	resp := append([]string{}, pLocations...)
+	for _, p := range pLocations {
+		resp = append(resp, strings.ToLower(UnOfficialLocation)+p)
+	}
+	return append(resp, "")
+}()
+
+// buildIndex index all files of roots by lower case path
+func (lib *Library) buildIndex() {
+	lib.index = make([]map[string]string, len(lib.roots))
+	for i, root := range lib.roots {
+		files := map[string]string{}
+		fs.WalkDir(root, ".", func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// unreadable dir is skipped, missing root is empty
+				return fs.SkipDir
+			}
+			if !d.IsDir() {
+				key := strings.ToLower(p)
+				if _, ok := files[key]; !ok {
+					files[key] = p
+				}
+			}
+			return nil
+		})
+		lib.index[i] = files
+	}
+}
+
+// resolve root and real path of lower case path
+func (lib *Library) resolve(key string) (fs.FS, string, bool) {
+	lib.once.Do(lib.buildIndex)
+	for i, files := range lib.index {
+		if real, ok := files[key]; ok {
+			return lib.roots[i], real, true
+		}
+	}
+	return nil, "", false
+}
+
+// Find library path of sub file reference name like `3001.DAT` or `S\3001s01.dat`,
+// the path can be opened with Open
+func (lib *Library) Find(name string) (string, error) {
+	name = strings.TrimPrefix(path.Clean(strings.ToLower(strings.ReplaceAll(name, "\\", "/"))), "/")
+
+	lib.once.Do(lib.buildIndex)
+	for _, files := range lib.index {
+		for _, p := range libraryLocations {
+			key := path.Clean(p + name)
+			if _, ok := files[key]; ok {
+				return key, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrSubFileNotFound, name)
+}
+
+// Files lower case paths of all files in dir of roots, like `parts/`,
+// file of later root is left out if an earlier root has same path
+func (lib *Library) Files(dir string) []string {
+	dir = strings.ToLower(dir)
+
+	lib.once.Do(lib.buildIndex)
+	seen := map[string]struct{}{}
+	resp := []string{}
+	for _, files := range lib.index {
+		for key := range files {
+			if _, ok := seen[key]; ok || !strings.HasPrefix(key, dir) {
+				continue
+			}
+			seen[key] = struct{}{}
+			resp = append(resp, key)
+		}
+	}
+	sort.Strings(resp)
+	return resp
+}
+
+// Open open file of library, name is case-insensitive
+func (lib *Library) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	root, real, ok := lib.resolve(strings.ToLower(name))
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return root.Open(real)
+}
@@ -0,0 +1,131 @@
+package ldraw
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLibraryFind(t *testing.T) {
+	official := fstest.MapFS{
+		"parts/3001.dat":            {Data: []byte("0 official")},
+		"Parts/S/3001s01.DAT":       {Data: []byte("0 sub part")},
+		"P/Stud.dat":                {Data: []byte("0 stud")},
+		"UnOfficial/parts/9999.dat": {Data: []byte("0 unofficial")},
+	}
+	personal := fstest.MapFS{
+		"3001.dat":   {Data: []byte("0 personal")},
+		"mine.dat":   {Data: []byte("0 mine")},
+		"p/stud.dat": {Data: []byte("0 personal stud")},
+	}
+	lib := NewLibrary(official, personal)
+
+	tests := []struct {
+		name, want, content string
+	}{
+		{"3001.DAT", "parts/3001.dat", "0 official"},
+		{`S\3001S01.dat`, "parts/s/3001s01.dat", "0 sub part"},
+		{"stud.dat", "p/stud.dat", "0 stud"},
+		{"9999.dat", "unofficial/parts/9999.dat", "0 unofficial"},
+		{"Mine.dat", "mine.dat", "0 mine"},
+	}
+	for _, tt := range tests {
+		got, err := lib.Find(tt.name)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: want %s, got %s %v", tt.name, tt.want, got, err)
+			continue
+		}
+
+		f, err := lib.Open(got)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		content, _ := io.ReadAll(f)
+		f.Close()
+		if string(content) != tt.content {
+			t.Errorf("%s: want %q, got %q", tt.name, tt.content, content)
+		}
+	}
+
+	if _, err := lib.Find("missing.dat"); !errors.Is(err, ErrSubFileNotFound) {
+		t.Errorf("want ErrSubFileNotFound, got %v", err)
+	}
+}
+
+func TestLibraryParseDatFS(t *testing.T) {
+	lib := NewLibrary(fstest.MapFS{
+		"PARTS/Box.dat":      {Data: []byte("0 box\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 S\\BoxS01.DAT\n")},
+		"parts/s/boxs01.dat": {Data: []byte("0 ~box side\n2 24 -10 0 -10 10 20 10\n")},
+	})
+
+	bb, err := ParseDatFS(lib, "parts/box.dat", InitMatrix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bb.CalcSize(); got != [3]float64{20, 20, 20} {
+		t.Errorf("wrong size: %v", got)
+	}
+}
+
+func TestNewLibraryPathsZip(t *testing.T) {
+	dir := t.TempDir()
+	complete := writeZip(t, filepath.Join(dir, "complete.zip"), map[string]string{
+		"ldraw/parts/3001.dat":      "0 official",
+		"ldraw/parts/s/3001s01.dat": "0 sub part",
+		"ldraw/p/stud.dat":          "0 stud",
+	})
+	unofficial := writeZip(t, filepath.Join(dir, "ldrawunf.zip"), map[string]string{
+		"parts/3001.dat": "0 unofficial",
+		"parts/9999.dat": "0 unofficial new",
+	})
+
+	lib, err := NewLibraryPaths(complete, unofficial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lib.Close()
+
+	for name, want := range map[string]string{"3001.dat": "0 official", `s\3001s01.dat`: "0 sub part", "9999.dat": "0 unofficial new"} {
+		p, err := lib.Find(name)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		content, err := fs.ReadFile(lib, p)
+		if err != nil || string(content) != want {
+			t.Errorf("%s: want %q, got %q %v", name, want, content, err)
+		}
+	}
+
+	if got := strings.Join(lib.Files(PartsLocation), ","); got != "parts/3001.dat,parts/9999.dat,parts/s/3001s01.dat" {
+		t.Errorf("wrong files: %s", got)
+	}
+}
+
+func writeZip(t *testing.T, fileName string, files map[string]string) string {
+	f, err := os.Create(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
@@ -0,0 +1,298 @@
+package ldraw
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// LdrLine one typed ldraw line
+type LdrLine interface {
+	// LineType ldraw line type 0-5, -1 for raw line
+	LineType() int
+	// LineNum line number in source file
+	LineNum() int
+	// LineText origin line text
+	LineText() string
+}
+
+// LineSource source info of one line
+type LineSource struct {
+	Num int    // line number, start from 1
+	Raw string // trimmed origin text
+}
+
+// LineNum LineNum
+func (ls *LineSource) LineNum() int {
+	return ls.Num
+}
+
+// LineText LineText
+func (ls *LineSource) LineText() string {
+	return ls.Raw
+}
+
+// Comment type 0 comment, `0 // text` or empty `0`
+type Comment struct {
+	LineSource
+	Text string
+}
+
+// Meta type 0 meta command, `0 !COMMAND args` or `0 COMMAND args`
+type Meta struct {
+	LineSource
+	Command string   // first word, with `!` if any
+	Args    []string // words after command
+	Text    string   // full text after `0`
+}
+
+// SubfileRef type 1 sub file reference
+type SubfileRef struct {
+	LineSource
+	Color  int
+	Pos    TransVector
+	Matrix [9]float64 // a b c d e f g h i
+	Name   string     // as written in file
+
+	Group   string // MLCad/LDCad group of reference, empty if none
+	Ignored bool   // not in parts list, in LPub PLI IGN/SUB block or Hidden
+	Hidden  bool   // temporary copy hidden by BUFEXCHG, not in assembled model
+}
+
+// Line type 2 line
+type Line struct {
+	LineSource
+	Color  int
+	Points [2]TransVector
+}
+
+// Triangle type 3 triangle
+type Triangle struct {
+	LineSource
+	Color  int
+	Points [3]TransVector
+}
+
+// Quad type 4 quadrilateral
+type Quad struct {
+	LineSource
+	Color  int
+	Points [4]TransVector
+}
+
+// OptionalLine type 5 optional line
+type OptionalLine struct {
+	LineSource
+	Color    int
+	Points   [2]TransVector
+	Controls [2]TransVector
+}
+
+// RawLine line ldraw viewers skip or tolerant parse could not read, like
+// unknown line type, kept as origin text to write back unchanged
+type RawLine struct {
+	LineSource
+	Err error // why line is not typed
+}
+
+func (*RawLine) LineType() int      { return -1 }
+func (*Comment) LineType() int      { return 0 }
+func (*Meta) LineType() int         { return 0 }
+func (*SubfileRef) LineType() int   { return 1 }
+func (*Line) LineType() int         { return 2 }
+func (*Triangle) LineType() int     { return 3 }
+func (*Quad) LineType() int         { return 4 }
+func (*OptionalLine) LineType() int { return 5 }
+
+// TransMatrix TransMatrix of sub file reference
+func (sr *SubfileRef) TransMatrix() *TransMatrix {
+	m := sr.Matrix
+	return &TransMatrix{
+		m[0], m[3], m[6], 0,
+		m[1], m[4], m[7], 0,
+		m[2], m[5], m[8], 0,
+		sr.Pos[0], sr.Pos[1], sr.Pos[2], 1,
+	}
+}
+
+// Vectors Vectors
+func (l *Line) Vectors() []*TransVector {
+	return []*TransVector{&l.Points[0], &l.Points[1]}
+}
+
+// Vectors Vectors
+func (t *Triangle) Vectors() []*TransVector {
+	return []*TransVector{&t.Points[0], &t.Points[1], &t.Points[2]}
+}
+
+// Vectors Vectors
+func (q *Quad) Vectors() []*TransVector {
+	return []*TransVector{&q.Points[0], &q.Points[1], &q.Points[2], &q.Points[3]}
+}
+
+// errSkipLine line ldraw viewers skip, like unknown line type or type 1 line
+// without file name. It does not fail strict parse, tolerant parse records it.
+var errSkipLine = fmt.Errorf("%w: skipped", ErrBadLine)
+
+// lineValueCounts values count of each line type, type 1 file name may contain space
+var lineValueCounts = map[string]int{"1": 15, "2": 8, "3": 11, "4": 14, "5": 14}
+
+// ParseLines read all non-empty lines of r into typed lines
+func ParseLines(r io.Reader, fileName string) ([]LdrLine, error) {
+	return parseLines(r, fileName, nil)
+}
+
+// parseLines parse lines, skipped lines and bad lines recorded in report if
+// not nil are kept as raw lines
+func parseLines(r io.Reader, fileName string, report *Report) ([]LdrLine, error) {
+	resp := []LdrLine{}
+
+	lineNum := 0
+	// start reading from the file with a reader.
+	reader := bufio.NewReader(r)
+	for {
+		lineNum++
+
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, &ParseError{File: fileName, Err: err}
+		}
+
+		if lineNum == 1 {
+			// remove optional utf8-bom
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		// old dos files may end with ctrl-z
+		line = strings.TrimSpace(strings.Trim(line, "\x1a"))
+		if line != "" {
+			one, errT := tokenizeLine(lineNum, line)
+			switch {
+			case errT == nil:
+				resp = append(resp, one)
+			case report == nil && errors.Is(errT, errSkipLine):
+				// skipped silently in strict mode
+				resp = append(resp, &RawLine{LineSource: LineSource{Num: lineNum, Raw: line}, Err: errT})
+			default:
+				if err := report.tolerate(ProblemBroken, fileName, &ParseError{File: fileName, Line: lineNum, Text: line, Err: errT}); err != nil {
+					return nil, err
+				}
+				resp = append(resp, &RawLine{LineSource: LineSource{Num: lineNum, Raw: line}, Err: errT})
+			}
+		}
+
+		if err == io.EOF {
+			return resp, nil
+		}
+	}
+}
+
+// tokenizeLine parse one trimmed line into typed line
+func tokenizeLine(num int, line string) (LdrLine, error) {
+	values := parseOneLine(line)
+	if len(values) == 0 {
+		return nil, ErrBadLine
+	}
+	src := LineSource{Num: num, Raw: line}
+
+	if values[0] == "0" {
+		text := restFields(line, 1)
+		if len(values) == 1 || strings.HasPrefix(values[1], "//") {
+			return &Comment{LineSource: src, Text: strings.TrimSpace(strings.TrimPrefix(text, "//"))}, nil
+		}
+		return &Meta{LineSource: src, Command: values[1], Args: values[2:], Text: text}, nil
+	}
+
+	count, ok := lineValueCounts[values[0]]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown line type %s", errSkipLine, values[0])
+	}
+	if values[0] == "1" && len(values) < count {
+		return nil, fmt.Errorf("%w: want %d values, got %d", errSkipLine, count, len(values))
+	}
+	if len(values) < count {
+		return nil, fmt.Errorf("%w: want %d values, got %d", ErrBadLine, count, len(values))
+	}
+	// values after points of type 2-5 lines are ignored
+
+	color, err := parseColorCode(values[1])
+	if err != nil {
+		return nil, err
+	}
+	numCount := count - 2
+	if values[0] == "1" {
+		numCount-- // last is file name
+	}
+	nums := make([]float64, numCount)
+	for i := range nums {
+		if nums[i], err = strconv.ParseFloat(values[i+2], 64); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBadLine, err)
+		}
+	}
+
+	switch values[0] {
+	case "1":
+		sr := &SubfileRef{LineSource: src, Color: color, Name: values[14]}
+		if len(values) > 15 {
+			// as file name can contain space, keep origin spacing
+			sr.Name = restFields(line, 14)
+		}
+		copy(sr.Pos[:], nums[:3])
+		copy(sr.Matrix[:], nums[3:])
+		return sr, nil
+	case "2":
+		l := &Line{LineSource: src, Color: color}
+		copyVectors(l.Points[:], nums)
+		return l, nil
+	case "3":
+		t := &Triangle{LineSource: src, Color: color}
+		copyVectors(t.Points[:], nums)
+		return t, nil
+	case "4":
+		q := &Quad{LineSource: src, Color: color}
+		copyVectors(q.Points[:], nums)
+		return q, nil
+	default:
+		o := &OptionalLine{LineSource: src, Color: color}
+		copyVectors(o.Points[:], nums[:6])
+		copyVectors(o.Controls[:], nums[6:])
+		return o, nil
+	}
+}
+
+// parseColorCode parse decimal or `0x` hex direct color code
+func parseColorCode(s string) (int, error) {
+	var v int64
+	var err error
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		v, err = strconv.ParseInt(s[2:], 16, 64)
+	} else {
+		v, err = strconv.ParseInt(s, 10, 64)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%w: bad color %s", ErrBadLine, s)
+	}
+	return int(v), nil
+}
+
+func copyVectors(dst []TransVector, nums []float64) {
+	for i := range dst {
+		copy(dst[i][:], nums[i*3:i*3+3])
+	}
+}
+
+// restFields text after first n fields
+func restFields(line string, n int) string {
+	s := strings.ReplaceAll(line, "\t", " ")
+	for i := 0; i < n; i++ {
+		s = strings.TrimLeft(s, " ")
+		j := strings.IndexByte(s, ' ')
+		if j < 0 {
+			return ""
+		}
+		s = s[j:]
+	}
+	return strings.TrimSpace(s)
+}
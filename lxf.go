@@ -0,0 +1,258 @@
+package ldraw
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// lddScale ldraw units of one LDD unit, a 0.8 LDD brick is 20 LDU wide
+const lddScale = 25
+
+// LDDMapping LDD design ids and materials to ldraw, content of LDD `ldraw.xml`
+type LDDMapping struct {
+	Materials map[string]int          // LDD material id -> ldraw color
+	Bricks    map[string]string       // LDD design id -> ldraw part file
+	Trans     map[string]*TransMatrix // ldraw part file -> ldraw part space to LDD part space
+}
+
+// NewLDDMapping empty mapping, design id is used as part number
+func NewLDDMapping() *LDDMapping {
+	return &LDDMapping{Materials: map[string]int{}, Bricks: map[string]string{}, Trans: map[string]*TransMatrix{}}
+}
+
+// lddMappingXML `<LDrawMapping>` of ldraw.xml
+type lddMappingXML struct {
+	Materials []struct {
+		LDraw string `xml:"ldraw,attr"`
+		LEGO  string `xml:"lego,attr"`
+	} `xml:"Material"`
+	Bricks []struct {
+		LDraw string `xml:"ldraw,attr"`
+		LEGO  string `xml:"lego,attr"`
+	} `xml:"Brick"`
+	Transformations []struct {
+		LDraw string  `xml:"ldraw,attr"`
+		TX    float64 `xml:"tx,attr"`
+		TY    float64 `xml:"ty,attr"`
+		TZ    float64 `xml:"tz,attr"`
+		AX    float64 `xml:"ax,attr"`
+		AY    float64 `xml:"ay,attr"`
+		AZ    float64 `xml:"az,attr"`
+		Angle float64 `xml:"angle,attr"`
+	} `xml:"Transformation"`
+}
+
+// LoadLDDMapping load mapping of LDD `ldraw.xml` content
+func LoadLDDMapping(r io.Reader) (*LDDMapping, error) {
+	got := &lddMappingXML{}
+	if err := xml.NewDecoder(r).Decode(got); err != nil {
+		return nil, err
+	}
+
+	resp := NewLDDMapping()
+	for _, m := range got.Materials {
+		color, err := parseColorCode(m.LDraw)
+		if err != nil {
+			return nil, err
+		}
+		resp.Materials[m.LEGO] = color
+	}
+	for _, b := range got.Bricks {
+		resp.Bricks[b.LEGO] = strings.ToLower(b.LDraw)
+	}
+	for _, t := range got.Transformations {
+		// rotate then move, in LDD units
+		m := AxisAngleMatrix(t.AX, t.AY, t.AZ, t.Angle)
+		m[12], m[13], m[14] = t.TX, t.TY, t.TZ
+		resp.Trans[strings.ToLower(t.LDraw)] = m
+	}
+	return resp, nil
+}
+
+// LoadLDDMappingFile load mapping of LDD `ldraw.xml` file
+func LoadLDDMappingFile(fileName string) (*LDDMapping, error) {
+	oneReader, errF := os.Open(fileName)
+	if errF != nil {
+		return nil, errF
+	}
+	defer oneReader.Close()
+
+	return LoadLDDMapping(oneReader)
+}
+
+// ParseLXFFile parse LDD .lxf (zip) or .lxfml (xml) file into mainFile
+func ParseLXFFile(fileName string, mapping *LDDMapping, mainFile *RawFile) error {
+	if strings.ToLower(path.Ext(fileName)) == ".lxfml" {
+		oneReader, errF := os.Open(fileName)
+		if errF != nil {
+			return &ParseError{File: fileName, Err: errF}
+		}
+		defer oneReader.Close()
+
+		return ParseLXFMLReader(oneReader, fileName, mapping, mainFile)
+	}
+
+	zr, err := zip.OpenReader(fileName)
+	if err != nil {
+		return &ParseError{File: fileName, Err: err}
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if strings.ToLower(path.Ext(f.Name)) != ".lxfml" {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return &ParseError{File: fileName, Err: err}
+		}
+		defer rc.Close()
+
+		return ParseLXFMLReader(rc, fileName, mapping, mainFile)
+	}
+	return &ParseError{File: fileName, Err: fmt.Errorf("%w: no lxfml in lxf", ErrSubFileNotFound)}
+}
+
+// ParseLXFMLReader parse LDD lxfml content into mainFile, each LDD part
+// becomes a type 1 line in mainFile.Lines
+func ParseLXFMLReader(r io.Reader, fileName string, mapping *LDDMapping, mainFile *RawFile) error {
+	if mapping == nil {
+		mapping = NewLDDMapping()
+	}
+
+	decoder := xml.NewDecoder(r)
+	var ref *SubfileRef // working part, waiting for bone
+	lineNum := 1
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return &ParseError{File: fileName, Err: err}
+		}
+
+		se, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch se.Name.Local {
+		case "LXFML":
+			name := xmlAttr(se, "name")
+			if name == "" {
+				name = strings.TrimSuffix(path.Base(fileName), path.Ext(fileName))
+			}
+			mainFile.Name = strings.ToLower(name)
+			if title, err := tokenizeLine(lineNum, "0 "+name); err == nil {
+				mainFile.Lines = append(mainFile.Lines, title)
+				lineNum++
+			}
+		case "Part":
+			ref = lddPartRef(se, mapping)
+		case "Bone":
+			if ref == nil {
+				continue
+			}
+
+			m, err := lddBoneMatrix(xmlAttr(se, "transformation"))
+			if err != nil {
+				return &ParseError{File: fileName, Line: lineNum, Text: xmlAttr(se, "transformation"), Err: err}
+			}
+			if corr, ok := mapping.Trans[strings.ToLower(ref.Name)]; ok {
+				m = MultipleMatrix(m, corr)
+			}
+			setRefMatrix(ref, lddToLDraw(m))
+
+			ref.Num = lineNum
+			lineNum++
+			mainFile.Lines = append(mainFile.Lines, ref)
+			mainFile.addStepRef(ref)
+			parseInlineFilePart(ref, mainFile)
+
+			// only first bone of part
+			ref = nil
+		}
+	}
+
+	mainFile.Header = ParseHeader(mainFile.Lines)
+	return nil
+}
+
+func xmlAttr(se xml.StartElement, name string) string {
+	for _, a := range se.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// lddPartRef sub file reference of `<Part designID materials>` or older `<Part designID materialID>`
+func lddPartRef(se xml.StartElement, mapping *LDDMapping) *SubfileRef {
+	designID := xmlAttr(se, "designID")
+	material := xmlAttr(se, "materialID")
+	if materials := xmlAttr(se, "materials"); materials != "" {
+		// first one is main material
+		material = strings.Split(materials, ",")[0]
+	}
+
+	ref := &SubfileRef{Color: MainColor, Name: designID + ".dat"}
+	if name, ok := mapping.Bricks[designID]; ok {
+		ref.Name = name
+	}
+	if color, ok := mapping.Materials[material]; ok {
+		ref.Color = color
+	}
+	return ref
+}
+
+// lddBoneMatrix matrix of bone `transformation`, 3 axis columns then position
+func lddBoneMatrix(s string) (*TransMatrix, error) {
+	values := strings.Split(s, ",")
+	if len(values) != 12 {
+		return nil, fmt.Errorf("%w: %s", ErrBadMatrix, s)
+	}
+
+	m := &TransMatrix{}
+	for i, v := range values {
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBadMatrix, err)
+		}
+		m[i+i/3] = f
+	}
+	m[15] = 1
+	return m, nil
+}
+
+// lddFlip ldraw space is LDD space rotated 180 degree around x
+var lddFlip = &TransMatrix{
+	1, 0, 0, 0,
+	0, -1, 0, 0,
+	0, 0, -1, 0,
+	0, 0, 0, 1,
+}
+
+// lddToLDraw convert LDD space matrix to ldraw space, position is scaled to LDU
+func lddToLDraw(m *TransMatrix) *TransMatrix {
+	resp := MultipleMatrix(MultipleMatrix(lddFlip, m), lddFlip)
+	resp[12], resp[13], resp[14] = resp[12]*lddScale, resp[13]*lddScale, resp[14]*lddScale
+	return resp
+}
+
+// setRefMatrix set position and matrix of sub file reference
+func setRefMatrix(ref *SubfileRef, m *TransMatrix) {
+	ref.Pos = TransVector{m[12], m[13], m[14]}
+	ref.Matrix = [9]float64{
+		m[0], m[4], m[8],
+		m[1], m[5], m[9],
+		m[2], m[6], m[10],
+	}
+}
@@ -0,0 +1,59 @@
+package ldraw
+
+import (
+	"strings"
+	"testing"
+)
+
+const testLDDMapping = `<?xml version="1.0" encoding="UTF-8"?>
+<LDrawMapping>
+  <Material ldraw="4" lego="21" />
+  <Brick ldraw="MyBrick.dat" lego="3001" />
+  <Transformation ldraw="mybrick.dat" tx="0" ty="0.96" tz="0" ax="0" ay="1" az="0" angle="0" />
+</LDrawMapping>`
+
+const testLXFML = `<?xml version="1.0" encoding="UTF-8" standalone="no" ?>
+<LXFML versionMajor="5" versionMinor="0" name="Car">
+  <Bricks cameraRef="0">
+    <Brick refID="0" designID="3001">
+      <Part refID="0" designID="3001" materials="21,0">
+        <Bone refID="0" transformation="0,0,-1,0,1,0,1,0,0,0.8,0,0.4">
+        </Bone>
+      </Part>
+    </Brick>
+    <Brick refID="1" designID="99999">
+      <Part refID="1" designID="99999" materials="194">
+        <Bone refID="1" transformation="1,0,0,0,1,0,0,0,1,0,0.96,0"/>
+      </Part>
+    </Brick>
+  </Bricks>
+</LXFML>`
+
+func TestParseLXFMLReader(t *testing.T) {
+	mapping, err := LoadLDDMapping(strings.NewReader(testLDDMapping))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mainFile := NewRawFile()
+	if err := ParseLXFMLReader(strings.NewReader(testLXFML), "car.lxfml", mapping, mainFile); err != nil {
+		t.Fatal(err)
+	}
+
+	if mainFile.Name != "car" || mainFile.Header.Title != "Car" {
+		t.Errorf("wrong name: %q", mainFile.Name)
+	}
+	if p := mainFile.Parts["mybrick.dat-4"]; p == nil || p.Count != 1 {
+		t.Errorf("wrong parts: %v", mainFile.Parts)
+	}
+	if p := mainFile.Parts["99999.dat-16"]; p == nil {
+		t.Errorf("unmapped part not kept: %v", mainFile.Parts)
+	}
+
+	if got, want := FormatLine(mainFile.Lines[1]), "1 4 20 -24 -10 0 0 -1 0 1 0 1 0 0 mybrick.dat"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if got, want := FormatLine(mainFile.Lines[2]), "1 16 0 -24 0 1 0 0 0 1 0 0 0 1 99999.dat"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
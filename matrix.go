@@ -32,18 +32,36 @@ func str2F64(s string) float64 {
 	return result
 }
 
-// NewTransMatrixFromStrs NewTransMatrixFromStrs
+// NewTransMatrixFromStrs NewTransMatrixFromStrs, fatal on error
 func NewTransMatrixFromStrs(d []string) *TransMatrix {
+	m, err := ParseTransMatrix(d)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return m
+}
+
+// ParseTransMatrix parse `x y z a b c d e f g h i` of type 1 line
+func ParseTransMatrix(d []string) (*TransMatrix, error) {
 	if len(d) != 12 {
-		log.Fatalf("string not match:%v", d)
+		return nil, fmt.Errorf("%w: %v", ErrBadMatrix, d)
 	}
 
-	return &TransMatrix{
-		str2F64(d[3]), str2F64(d[6]), str2F64(d[9]), 0,
-		str2F64(d[4]), str2F64(d[7]), str2F64(d[10]), 0,
-		str2F64(d[5]), str2F64(d[8]), str2F64(d[11]), 0,
-		str2F64(d[0]), str2F64(d[1]), str2F64(d[2]), 1,
+	f := [12]float64{}
+	for i, s := range d {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBadMatrix, err)
+		}
+		f[i] = v
 	}
+
+	return &TransMatrix{
+		f[3], f[6], f[9], 0,
+		f[4], f[7], f[10], 0,
+		f[5], f[8], f[11], 0,
+		f[0], f[1], f[2], 1,
+	}, nil
 }
 
 // NewVectorsFromLine NewVectorsFromLine
@@ -62,28 +80,34 @@ func NewVectorsFromLine(d []string, vCount int) []*TransVector {
 
 // MultipleMatrix https://www.migenius.com/articles/3d-transformations-part1-matrices
 func MultipleMatrix(l, r *TransMatrix) *TransMatrix {
-	result := &TransMatrix{}
+	result := l.Mul(r)
+	return &result
+}
+
+// Mul matrix product m * r by value, allocation free MultipleMatrix
+func (m *TransMatrix) Mul(r *TransMatrix) TransMatrix {
+	result := TransMatrix{}
 
 	/*
 		{\displaystyle \mathbf {C} ={\begin{pmatrix}a_{11}b_{11}+\cdots +a_{1n}b_{n1}&a_{11}b_{12}+\cdots +a_{1n}b_{n2}&\cdots &a_{11}b_{1p}+\cdots +a_{1n}b_{np}\\a_{21}b_{11}+\cdots +a_{2n}b_{n1}&a_{21}b_{12}+\cdots +a_{2n}b_{n2}&\cdots &a_{21}b_{1p}+\cdots +a_{2n}b_{np}\\\vdots &\vdots &\ddots &\vdots \\a_{m1}b_{11}+\cdots +a_{mn}b_{n1}&a_{m1}b_{12}+\cdots +a_{mn}b_{n2}&\cdots &a_{m1}b_{1p}+\cdots +a_{mn}b_{np}\\\end{pmatrix}}}
 	*/
 	// https://en.wikipedia.org/wiki/Matrix_multiplication
-	result[0] = l[0]*r[0] + l[4]*r[1] + l[8]*r[2] + l[12]*r[3]
-	result[1] = l[1]*r[0] + l[5]*r[1] + l[9]*r[2] + l[13]*r[3]
-	result[2] = l[2]*r[0] + l[6]*r[1] + l[10]*r[2] + l[14]*r[3]
-	result[3] = l[3]*r[0] + l[7]*r[1] + l[11]*r[2] + l[15]*r[3]
-	result[4] = l[0]*r[4] + l[4]*r[5] + l[8]*r[6] + l[12]*r[7]
-	result[5] = l[1]*r[4] + l[5]*r[5] + l[9]*r[6] + l[13]*r[7]
-	result[6] = l[2]*r[4] + l[6]*r[5] + l[10]*r[6] + l[14]*r[7]
-	result[7] = l[3]*r[4] + l[7]*r[5] + l[11]*r[6] + l[15]*r[7]
-	result[8] = l[0]*r[8] + l[4]*r[9] + l[8]*r[10] + l[12]*r[11]
-	result[9] = l[1]*r[8] + l[5]*r[9] + l[9]*r[10] + l[13]*r[11]
-	result[10] = l[2]*r[8] + l[6]*r[9] + l[10]*r[10] + l[14]*r[11]
-	result[11] = l[3]*r[8] + l[7]*r[9] + l[11]*r[10] + l[15]*r[11]
-	result[12] = l[0]*r[12] + l[4]*r[13] + l[8]*r[14] + l[12]*r[15]
-	result[13] = l[1]*r[12] + l[5]*r[13] + l[9]*r[14] + l[13]*r[15]
-	result[14] = l[2]*r[12] + l[6]*r[13] + l[10]*r[14] + l[14]*r[15]
-	result[15] = l[3]*r[12] + l[7]*r[13] + l[11]*r[14] + l[15]*r[15]
+	result[0] = m[0]*r[0] + m[4]*r[1] + m[8]*r[2] + m[12]*r[3]
+	result[1] = m[1]*r[0] + m[5]*r[1] + m[9]*r[2] + m[13]*r[3]
+	result[2] = m[2]*r[0] + m[6]*r[1] + m[10]*r[2] + m[14]*r[3]
+	result[3] = m[3]*r[0] + m[7]*r[1] + m[11]*r[2] + m[15]*r[3]
+	result[4] = m[0]*r[4] + m[4]*r[5] + m[8]*r[6] + m[12]*r[7]
+	result[5] = m[1]*r[4] + m[5]*r[5] + m[9]*r[6] + m[13]*r[7]
+	result[6] = m[2]*r[4] + m[6]*r[5] + m[10]*r[6] + m[14]*r[7]
+	result[7] = m[3]*r[4] + m[7]*r[5] + m[11]*r[6] + m[15]*r[7]
+	result[8] = m[0]*r[8] + m[4]*r[9] + m[8]*r[10] + m[12]*r[11]
+	result[9] = m[1]*r[8] + m[5]*r[9] + m[9]*r[10] + m[13]*r[11]
+	result[10] = m[2]*r[8] + m[6]*r[9] + m[10]*r[10] + m[14]*r[11]
+	result[11] = m[3]*r[8] + m[7]*r[9] + m[11]*r[10] + m[15]*r[11]
+	result[12] = m[0]*r[12] + m[4]*r[13] + m[8]*r[14] + m[12]*r[15]
+	result[13] = m[1]*r[12] + m[5]*r[13] + m[9]*r[14] + m[13]*r[15]
+	result[14] = m[2]*r[12] + m[6]*r[13] + m[10]*r[14] + m[14]*r[15]
+	result[15] = m[3]*r[12] + m[7]*r[13] + m[11]*r[14] + m[15]*r[15]
 
 	return result
 }
@@ -93,37 +117,40 @@ type TransVector [3]float64
 
 // MultipleVector https://www.ldraw.org/article/218.html
 func MultipleVector(m *TransMatrix, vs ...*TransVector) []*TransVector {
-	results := []*TransVector{}
-
+	results := make([]*TransVector, 0, len(vs))
 	for _, v := range vs {
-		result := &TransVector{}
-		// u' = a*u + b*v + c*w + x
-		// v' = d*u + e*v + f*w + y
-		// w' = g*u + h*v + i*w + z
-		result[0] = m[0]*v[0] + m[4]*v[1] + m[8]*v[2] + m[12]
-		result[1] = m[1]*v[0] + m[5]*v[1] + m[9]*v[2] + m[13]
-		result[2] = m[2]*v[0] + m[6]*v[1] + m[10]*v[2] + m[14]
-
-		results = append(results, result)
+		result := m.Apply(*v)
+		results = append(results, &result)
 	}
-
 	return results
 }
 
+// Apply vector transformed by m, allocation free MultipleVector
+func (m *TransMatrix) Apply(v TransVector) TransVector {
+	// u' = a*u + b*v + c*w + x
+	// v' = d*u + e*v + f*w + y
+	// w' = g*u + h*v + i*w + z
+	return TransVector{
+		m[0]*v[0] + m[4]*v[1] + m[8]*v[2] + m[12],
+		m[1]*v[0] + m[5]*v[1] + m[9]*v[2] + m[13],
+		m[2]*v[0] + m[6]*v[1] + m[10]*v[2] + m[14],
+	}
+}
+
 func (tv *TransVector) String() string {
 	return fmt.Sprintf("[%7.2f,%7.2f,%7.2f]", tv[0], tv[1], tv[2])
 }
 
-// BoundingBox BoundingBox
+// BoundingBox BoundingBox, corners are held by value so a box is one allocation
 type BoundingBox struct {
-	Min, Max *TransVector
+	Min, Max TransVector
 }
 
-// NewBoundingBox NewBoundingBox
+// NewBoundingBox empty box, any merged vector grows it
 func NewBoundingBox() *BoundingBox {
 	return &BoundingBox{
-		Min: &TransVector{math.Inf(1), math.Inf(1), math.Inf(1)},
-		Max: &TransVector{math.Inf(-1), math.Inf(-1), math.Inf(-1)},
+		Min: TransVector{math.Inf(1), math.Inf(1), math.Inf(1)},
+		Max: TransVector{math.Inf(-1), math.Inf(-1), math.Inf(-1)},
 	}
 }
 
@@ -131,7 +158,7 @@ func NewBoundingBox() *BoundingBox {
 func (bb *BoundingBox) TransEmpty() *BoundingBox {
 	if bb.Min[0] == math.Inf(1) && bb.Min[1] == math.Inf(1) && bb.Min[2] == math.Inf(1) &&
 		bb.Max[0] == math.Inf(-1) && bb.Max[0] == math.Inf(-1) && bb.Max[0] == math.Inf(-1) {
-		return &BoundingBox{Min: &TransVector{0, 0, 0}, Max: &TransVector{0, 0, 0}}
+		return &BoundingBox{}
 	}
 	return bb
 }
@@ -144,28 +171,50 @@ func (bb *BoundingBox) ToGob() [2][3]float64 {
 // MergeMinMaxVector MergeMinMaxVector
 func (bb *BoundingBox) MergeMinMaxVector(news ...*TransVector) {
 	for _, new := range news {
-		if new[0] < bb.Min[0] {
-			bb.Min[0] = new[0]
-		}
-		if new[1] < bb.Min[1] {
-			bb.Min[1] = new[1]
-		}
-		if new[2] < bb.Min[2] {
-			bb.Min[2] = new[2]
-		}
+		bb.Merge(*new)
+	}
+}
 
-		if new[0] > bb.Max[0] {
-			bb.Max[0] = new[0]
-		}
-		if new[1] > bb.Max[1] {
-			bb.Max[1] = new[1]
-		}
-		if new[2] > bb.Max[2] {
-			bb.Max[2] = new[2]
+// Merge grow box to hold vectors
+func (bb *BoundingBox) Merge(vs ...TransVector) {
+	for _, v := range vs {
+		for i := 0; i < 3; i++ {
+			if v[i] < bb.Min[i] {
+				bb.Min[i] = v[i]
+			}
+			if v[i] > bb.Max[i] {
+				bb.Max[i] = v[i]
+			}
 		}
 	}
 }
 
+// MergeTransformed grow box to hold vectors transformed by m, vectors are
+// not changed
+func (bb *BoundingBox) MergeTransformed(m *TransMatrix, vs ...TransVector) {
+	for _, v := range vs {
+		bb.Merge(m.Apply(v))
+	}
+}
+
+// Transform bounding box of box transformed by m, all eight corners are
+// transformed so rotated boxes keep their extents
+func (bb *BoundingBox) Transform(m *TransMatrix) *BoundingBox {
+	resp := NewBoundingBox()
+	resp.MergeBox(m, bb)
+	return resp
+}
+
+// MergeBox grow box to hold box transformed by m, see Transform
+func (bb *BoundingBox) MergeBox(m *TransMatrix, box *BoundingBox) {
+	if box.Min[0] > box.Max[0] || box.Min[1] > box.Max[1] || box.Min[2] > box.Max[2] {
+		// empty
+		return
+	}
+	corners := boxCorners(box.ToGob())
+	bb.MergeTransformed(m, corners[:]...)
+}
+
 // CalcSize Calc LDU Size
 func (bb *BoundingBox) CalcSize() [3]float64 {
 	return [3]float64{
@@ -188,3 +237,194 @@ func GetBoxWHTByX(b [2][3]float64) (float64, float64, float64) {
 	tall := b[1][1] - b[0][1]   // y
 	return width, height, tall
 }
+
+// boxCorners eight corners of bounding box
+func boxCorners(b [2][3]float64) [8]TransVector {
+	resp := [8]TransVector{}
+	for i := range resp {
+		resp[i] = TransVector{b[i&1][0], b[(i>>1)&1][1], b[(i>>2)&1][2]}
+	}
+	return resp
+}
+
+// rotationBetween rotation matrix turns unit vector from to unit vector to
+func rotationBetween(from, to TransVector) *TransMatrix {
+	axis := TransVector{
+		from[1]*to[2] - from[2]*to[1],
+		from[2]*to[0] - from[0]*to[2],
+		from[0]*to[1] - from[1]*to[0],
+	}
+	cos := from[0]*to[0] + from[1]*to[1] + from[2]*to[2]
+	if vectorDistance(axis, TransVector{}) < 1e-9 {
+		if cos > 0 {
+			m := *InitMatrix
+			return &m
+		}
+		// opposite, turn half around any perpendicular axis
+		axis = TransVector{-from[1], from[0], 0}
+		if vectorDistance(axis, TransVector{}) < 1e-9 {
+			axis = TransVector{0, -from[2], from[1]}
+		}
+	}
+	return AxisAngleMatrix(axis[0], axis[1], axis[2], math.Acos(math.Max(-1, math.Min(1, cos))))
+}
+
+// Determinant determinant of rotation part, negative for mirrored, 0 for singular
+func (m *TransMatrix) Determinant() float64 {
+	return m[0]*(m[5]*m[10]-m[9]*m[6]) -
+		m[4]*(m[1]*m[10]-m[9]*m[2]) +
+		m[8]*(m[1]*m[6]-m[5]*m[2])
+}
+
+// IsOrthonormal axes of rotation part are unit length and perpendicular
+// within tolerance, mirrored is allowed
+func (m *TransMatrix) IsOrthonormal(tolerance float64) bool {
+	axes := [3]TransVector{{m[0], m[1], m[2]}, {m[4], m[5], m[6]}, {m[8], m[9], m[10]}}
+	for i := 0; i < 3; i++ {
+		for j := i; j < 3; j++ {
+			dot := axes[i][0]*axes[j][0] + axes[i][1]*axes[j][1] + axes[i][2]*axes[j][2]
+			want := 0.0
+			if i == j {
+				want = 1
+			}
+			if math.Abs(dot-want) > tolerance {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// axisAligned each axis is mapped onto one axis, so transformed bounding box
+// of corners is exact
+func (m *TransMatrix) axisAligned() bool {
+	for i := 0; i < 3; i++ {
+		n := 0
+		for _, v := range []float64{m[i], m[4+i], m[8+i]} {
+			if math.Abs(v) > 1e-9 {
+				n++
+			}
+		}
+		if n > 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// Transpose transposed matrix
+func (m *TransMatrix) Transpose() *TransMatrix {
+	resp := &TransMatrix{}
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			resp[i*4+j] = m[j*4+i]
+		}
+	}
+	return resp
+}
+
+// Inverse inverse of transform, ErrBadMatrix if singular
+func (m *TransMatrix) Inverse() (*TransMatrix, error) {
+	det := m.Determinant()
+	if math.Abs(det) < 1e-12 {
+		return nil, fmt.Errorf("%w: singular %v", ErrBadMatrix, m)
+	}
+
+	// inverse of rotation part by cofactors
+	resp := &TransMatrix{
+		(m[5]*m[10] - m[9]*m[6]) / det, (m[9]*m[2] - m[1]*m[10]) / det, (m[1]*m[6] - m[5]*m[2]) / det, 0,
+		(m[8]*m[6] - m[4]*m[10]) / det, (m[0]*m[10] - m[8]*m[2]) / det, (m[4]*m[2] - m[0]*m[6]) / det, 0,
+		(m[4]*m[9] - m[8]*m[5]) / det, (m[8]*m[1] - m[0]*m[9]) / det, (m[0]*m[5] - m[4]*m[1]) / det, 0,
+		0, 0, 0, 1,
+	}
+	// move back by rotated translation
+	t := MultipleVector(resp, &TransVector{m[12], m[13], m[14]})[0]
+	resp[12], resp[13], resp[14] = -t[0], -t[1], -t[2]
+	return resp, nil
+}
+
+// Decompose split transform into translation, rotation and scale, so that
+// m = translation * rotation * scale. Mirrored matrix gets negative x scale,
+// shear is not kept.
+func (m *TransMatrix) Decompose() (translation TransVector, rotation *TransMatrix, scale TransVector) {
+	translation = TransVector{m[12], m[13], m[14]}
+
+	rotation = &TransMatrix{}
+	rotation[15] = 1
+	for i := 0; i < 3; i++ {
+		scale[i] = math.Sqrt(m[i*4]*m[i*4] + m[i*4+1]*m[i*4+1] + m[i*4+2]*m[i*4+2])
+	}
+	if m.Determinant() < 0 {
+		scale[0] = -scale[0]
+	}
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			if scale[i] != 0 {
+				rotation[i*4+j] = m[i*4+j] / scale[i]
+			}
+		}
+	}
+	return translation, rotation, scale
+}
+
+// TranslationMatrix matrix moves by x, y, z
+func TranslationMatrix(x, y, z float64) *TransMatrix {
+	m := *InitMatrix
+	m[12], m[13], m[14] = x, y, z
+	return &m
+}
+
+// ScaleMatrix matrix scales axes by x, y, z
+func ScaleMatrix(x, y, z float64) *TransMatrix {
+	m := *InitMatrix
+	m[0], m[5], m[10] = x, y, z
+	return &m
+}
+
+// AxisAngleMatrix rotation matrix of angle (radian) around axis
+func AxisAngleMatrix(x, y, z, angle float64) *TransMatrix {
+	l := math.Sqrt(x*x + y*y + z*z)
+	if l == 0 {
+		m := *InitMatrix
+		return &m
+	}
+	x, y, z = x/l, y/l, z/l
+
+	c, s := math.Cos(angle), math.Sin(angle)
+	t := 1 - c
+	return &TransMatrix{
+		t*x*x + c, t*x*y + s*z, t*x*z - s*y, 0,
+		t*x*y - s*z, t*y*y + c, t*y*z + s*x, 0,
+		t*x*z + s*y, t*y*z - s*x, t*z*z + c, 0,
+		0, 0, 0, 1,
+	}
+}
+
+// EulerMatrix rotation matrix of angles (radian) around x, then y, then z
+// axis, m = Rz * Ry * Rx
+func EulerMatrix(x, y, z float64) *TransMatrix {
+	return MultipleMatrix(AxisAngleMatrix(0, 0, 1, z), MultipleMatrix(AxisAngleMatrix(0, 1, 0, y), AxisAngleMatrix(1, 0, 0, x)))
+}
+
+// QuaternionMatrix rotation matrix of quaternion w + xi + yj + zk, it is
+// normalized first
+func QuaternionMatrix(w, x, y, z float64) *TransMatrix {
+	l := math.Sqrt(w*w + x*x + y*y + z*z)
+	if l == 0 {
+		m := *InitMatrix
+		return &m
+	}
+	w, x, y, z = w/l, x/l, y/l, z/l
+
+	return &TransMatrix{
+		1 - 2*(y*y+z*z), 2 * (x*y + w*z), 2 * (x*z - w*y), 0,
+		2 * (x*y - w*z), 1 - 2*(x*x+z*z), 2 * (y*z + w*x), 0,
+		2 * (x*z + w*y), 2 * (y*z - w*x), 1 - 2*(x*x+y*y), 0,
+		0, 0, 0, 1,
+	}
+}
+
+// String `x y z a b c d e f g h i` of type 1 line, reverse of ParseTransMatrix
+func (m *TransMatrix) String() string {
+	return formatFloats(m[12], m[13], m[14], m[0], m[4], m[8], m[1], m[5], m[9], m[2], m[6], m[10])
+}
@@ -0,0 +1,162 @@
+package ldraw
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func matrixNear(l, r *TransMatrix) bool {
+	for i := range l {
+		if math.Abs(l[i]-r[i]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTransMatrixDeterminant(t *testing.T) {
+	m := AxisAngleMatrix(1, 1, 0, 0.7)
+	if d := m.Determinant(); d < 1-1e-9 || d > 1+1e-9 || !m.IsOrthonormal(1e-9) {
+		t.Errorf("rotation: determinant %v, orthonormal %v", d, m.IsOrthonormal(1e-9))
+	}
+	if d := MultipleMatrix(m, lddFlip).Determinant(); d < 1-1e-9 || d > 1+1e-9 {
+		t.Errorf("want rotation, got determinant %v", d)
+	}
+	mirror := &TransMatrix{-1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1}
+	if d := mirror.Determinant(); d != -1 || !mirror.IsOrthonormal(1e-9) {
+		t.Errorf("mirror: determinant %v", d)
+	}
+}
+
+func TestTransMatrixInverse(t *testing.T) {
+	m := MultipleMatrix(TranslationMatrix(10, -24, 5), MultipleMatrix(EulerMatrix(0.3, -1.2, 2), ScaleMatrix(-1, 2, 0.5)))
+	inv, err := m.Inverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := MultipleMatrix(m, inv); !matrixNear(got, InitMatrix) {
+		t.Errorf("want identity, got %v", got)
+	}
+	if got := MultipleMatrix(inv, m); !matrixNear(got, InitMatrix) {
+		t.Errorf("want identity, got %v", got)
+	}
+
+	if _, err := ScaleMatrix(1, 0, 1).Inverse(); !errors.Is(err, ErrBadMatrix) {
+		t.Errorf("want ErrBadMatrix, got %v", err)
+	}
+
+	// inverse of rotation is transpose
+	r := AxisAngleMatrix(1, 2, 3, 0.8)
+	inv, _ = r.Inverse()
+	if !matrixNear(inv, r.Transpose()) {
+		t.Errorf("want %v, got %v", r.Transpose(), inv)
+	}
+}
+
+func TestTransMatrixDecompose(t *testing.T) {
+	rotation := EulerMatrix(0.5, 0.1, -0.7)
+	for _, scale := range []TransVector{{1, 1, 1}, {2, 3, 4}, {-1, 1, 1}} {
+		m := MultipleMatrix(TranslationMatrix(1, 2, 3), MultipleMatrix(rotation, ScaleMatrix(scale[0], scale[1], scale[2])))
+		translation, gotRotation, gotScale := m.Decompose()
+		if translation != (TransVector{1, 2, 3}) {
+			t.Errorf("want translation [1 2 3], got %v", translation)
+		}
+		if !matrixNear(gotRotation, rotation) || math.Abs(gotRotation.Determinant()-1) > 1e-9 {
+			t.Errorf("scale %v: want rotation %v, got %v", scale, rotation, gotRotation)
+		}
+		for i := range scale {
+			if math.Abs(gotScale[i]-scale[i]) > 1e-9 {
+				t.Errorf("want scale %v, got %v", scale, gotScale)
+			}
+		}
+	}
+}
+
+func TestTransMatrixRotations(t *testing.T) {
+	// quarter turn around y moves x onto -z
+	want := &TransMatrix{0, 0, -1, 0, 0, 1, 0, 0, 1, 0, 0, 0, 0, 0, 0, 1}
+	half := math.Sqrt(0.5)
+	for name, m := range map[string]*TransMatrix{
+		"axis":       AxisAngleMatrix(0, 2, 0, math.Pi/2),
+		"euler":      EulerMatrix(0, math.Pi/2, 0),
+		"quaternion": QuaternionMatrix(2*half, 0, 2*half, 0),
+	} {
+		if !matrixNear(m, want) {
+			t.Errorf("%s: want %v, got %v", name, want, m)
+		}
+	}
+
+	// euler x then y then z
+	euler := EulerMatrix(0.4, 0.5, 0.6)
+	byAxis := MultipleMatrix(AxisAngleMatrix(0, 0, 1, 0.6), MultipleMatrix(AxisAngleMatrix(0, 1, 0, 0.5), AxisAngleMatrix(1, 0, 0, 0.4)))
+	if !matrixNear(euler, byAxis) {
+		t.Errorf("want %v, got %v", byAxis, euler)
+	}
+
+	// quaternion of angle around axis
+	s := math.Sin(0.35)
+	if q, a := QuaternionMatrix(math.Cos(0.35), s/3, 2*s/3, 2*s/3), AxisAngleMatrix(1, 2, 2, 0.7); !matrixNear(q, a) {
+		t.Errorf("want %v, got %v", a, q)
+	}
+}
+
+func TestTransMatrixString(t *testing.T) {
+	fields := strings.Fields("10 -24 0.5 0 0 1 0 1 0 -1 0 0")
+	m, err := ParseTransMatrix(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.String(); got != strings.Join(fields, " ") {
+		t.Errorf("want %s, got %s", strings.Join(fields, " "), got)
+	}
+	if got := MultipleMatrix(m, InitMatrix).Transpose().Transpose().String(); got != m.String() {
+		t.Errorf("want %s, got %s", m, got)
+	}
+}
+
+func BenchmarkMergeMinMaxVector(b *testing.B) {
+	m := EulerMatrix(0.1, 0.2, 0.3)
+	q := &Quad{Points: [4]TransVector{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}, {10, 11, 12}}}
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		bb := NewBoundingBox()
+		bb.MergeMinMaxVector(MultipleVector(m, q.Vectors()...)...)
+	}
+}
+
+func BenchmarkMergeTransformed(b *testing.B) {
+	m := EulerMatrix(0.1, 0.2, 0.3)
+	q := &Quad{Points: [4]TransVector{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}, {10, 11, 12}}}
+	bb := NewBoundingBox()
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		bb.Min, bb.Max = TransVector{}, TransVector{}
+		bb.MergeTransformed(m, q.Points[:]...)
+	}
+}
+
+func TestMergeTransformed(t *testing.T) {
+	m := MultipleMatrix(TranslationMatrix(1, 2, 3), EulerMatrix(0.1, 0.2, 0.3))
+	q := &Quad{Points: [4]TransVector{{1, 2, 3}, {4, 5, 6}, {-7, 8, 9}, {10, -11, 12}}}
+
+	want := NewBoundingBox()
+	want.MergeMinMaxVector(MultipleVector(m, q.Vectors()...)...)
+	got := NewBoundingBox()
+	got.MergeTransformed(m, q.Points[:]...)
+	if got.Min != want.Min || got.Max != want.Max {
+		t.Errorf("want %v %v, got %v %v", want.Min, want.Max, got.Min, got.Max)
+	}
+	if q.Points[2] != (TransVector{-7, 8, 9}) {
+		t.Errorf("vectors changed: %v", q.Points)
+	}
+
+	if allocs := testing.AllocsPerRun(100, func() {
+		sub := m.Mul(InitMatrix)
+		got.MergeTransformed(&sub, q.Points[:]...)
+		got.MergeBox(&sub, want)
+	}); allocs != 0 {
+		t.Errorf("want no allocs, got %v", allocs)
+	}
+}
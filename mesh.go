@@ -0,0 +1,230 @@
+package ldraw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MeshTriangle triangle of mesh, quads are split in two
+type MeshTriangle struct {
+	Points   [3]TransVector // counter-clockwise seen from front, like `0 BFC CCW`
+	Color    int
+	TwoSided bool // not BFC certified or NOCLIP, winding is as written and both sides are seen
+}
+
+// MeshLine edge line of type 2 line
+type MeshLine struct {
+	Points [2]TransVector
+	Color  int
+}
+
+// MeshOptionalLine conditional line of type 5 line, drawn only if controls
+// are on same side of it
+type MeshOptionalLine struct {
+	Points   [2]TransVector
+	Controls [2]TransVector
+	Color    int
+}
+
+// Mesh geometry of part or model with world transforms and resolved colors
+type Mesh struct {
+	Triangles     []MeshTriangle
+	Lines         []MeshLine
+	OptionalLines []MeshOptionalLine
+}
+
+// MeshDat mesh of dat file in library placed with matrix and color, sub files
+// are read once per parser. Tolerant mode if report is set, like
+// ParseDatContext. Edge color 24 is resolved by edge of parent color in
+// colors, which can be nil.
+func (p *Parser) MeshDat(ctx context.Context, fileName string, matrix *TransMatrix, color int, colors *ColorTable, report *Report) (*Mesh, error) {
+	lines, err := p.meshLines(ctx, fileName, report)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &meshWalker{p: p, ctx: ctx, report: report, colors: colors, mesh: &Mesh{}}
+	if err := w.walk(lines, fileName, matrix, color, false, true, false, []string{fileName}); err != nil {
+		return nil, err
+	}
+	return w.mesh, nil
+}
+
+// MeshModel mesh of parsed model, inline sub files are walked and parts are
+// read from library of parser. All placed parts are meshed, also ones left
+// out of parts list, but not copies hidden by BUFEXCHG. Model files need no
+// BFC certification, parts placed by them are culled by their own. Local
+// colors of model files override colors. Tolerant mode if rawFile.Report is set.
+func (p *Parser) MeshModel(ctx context.Context, rawFile *RawFile, colors *ColorTable) (*Mesh, error) {
+	w := &meshWalker{
+		p: p, ctx: ctx, report: rawFile.Report, colors: overlayColors(rawFile.Colors, colors),
+		models: rawFile.SubFiles, mesh: &Mesh{},
+	}
+	if err := w.walk(rawFile.Lines, rawFile.Name, InitMatrix, MainColor, false, true, true, []string{rawFile.Name}); err != nil {
+		return nil, err
+	}
+	return w.mesh, nil
+}
+
+// meshLines lines of library file, read once per parser unless lines had
+// problems
+func (p *Parser) meshLines(ctx context.Context, fileName string, report *Report) ([]LdrLine, error) {
+	if got, ok := p.lines.Load(fileName); ok {
+		return got.([]LdrLine), nil
+	}
+	if p.Library == nil {
+		return nil, &ParseError{File: fileName, Err: ErrSubFileNotFound}
+	}
+
+	own := report.child()
+	lines, err := p.readDat(ctx, fileName, func() (io.ReadCloser, error) { return p.Library.Open(fileName) }, own)
+	if err != nil {
+		return nil, err
+	}
+	if own.clean() {
+		p.lines.Store(fileName, lines)
+	}
+	return lines, nil
+}
+
+// meshWalker walks files into mesh
+type meshWalker struct {
+	p      *Parser
+	ctx    context.Context
+	report *Report
+	colors *ColorTable
+	models map[string]*RawFile // inline sub files of model
+	mesh   *Mesh
+}
+
+// walk add geometry of file lines. invert is accumulated `0 BFC INVERTNEXT`,
+// clip is false if a parent turned culling off, model files keep culling
+// of their sub files without certification.
+func (w *meshWalker) walk(lines []LdrLine, fileName string, matrix *TransMatrix, color int, invert, clip, model bool, stack []string) error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+
+	// BFC state of file
+	certified, ccw, localClip, invertNext := false, true, true, false
+	mirrored := matrix.Determinant() < 0
+
+	for _, one := range lines {
+		switch l := one.(type) {
+		case *Meta:
+			switch l.Command {
+			case "NOFILE":
+				return nil
+			case "BFC":
+				for _, arg := range l.Args {
+					switch strings.ToUpper(arg) {
+					case "CERTIFY":
+						certified = true
+					case "NOCERTIFY":
+						certified = false
+					case "CCW":
+						ccw = true
+					case "CW":
+						ccw = false
+					case "CLIP":
+						localClip = true
+					case "NOCLIP":
+						localClip = false
+					case "INVERTNEXT":
+						invertNext = true
+					}
+				}
+			}
+			continue
+		case *SubfileRef:
+			if l.Hidden {
+				// temporary copy of BUFEXCHG, not in model
+				break
+			}
+			subMatrix := matrix.Mul(l.TransMatrix())
+			subClip := clip && (certified || model) && localClip
+			if err := w.walkRef(l, fileName, &subMatrix, inheritColor(l.Color, color, w.colors), invert != invertNext, subClip, stack); err != nil {
+				return err
+			}
+		case *Triangle:
+			w.addTriangle(l.Points, inheritColor(l.Color, color, w.colors), !ccw != (invert != mirrored), clip && certified && localClip, matrix)
+		case *Quad:
+			c := inheritColor(l.Color, color, w.colors)
+			flip := !ccw != (invert != mirrored)
+			w.addTriangle([3]TransVector{l.Points[0], l.Points[1], l.Points[2]}, c, flip, clip && certified && localClip, matrix)
+			w.addTriangle([3]TransVector{l.Points[0], l.Points[2], l.Points[3]}, c, flip, clip && certified && localClip, matrix)
+		case *Line:
+			w.mesh.Lines = append(w.mesh.Lines, MeshLine{
+				Points: [2]TransVector{matrix.Apply(l.Points[0]), matrix.Apply(l.Points[1])},
+				Color:  inheritColor(l.Color, color, w.colors),
+			})
+		case *OptionalLine:
+			w.mesh.OptionalLines = append(w.mesh.OptionalLines, MeshOptionalLine{
+				Points:   [2]TransVector{matrix.Apply(l.Points[0]), matrix.Apply(l.Points[1])},
+				Controls: [2]TransVector{matrix.Apply(l.Controls[0]), matrix.Apply(l.Controls[1])},
+				Color:    inheritColor(l.Color, color, w.colors),
+			})
+		default:
+			continue
+		}
+		// INVERTNEXT is for next drawing line only
+		invertNext = false
+	}
+	return nil
+}
+
+// walkRef add geometry of sub file, inline sub files of model first
+func (w *meshWalker) walkRef(ref *SubfileRef, fileName string, matrix *TransMatrix, color int, invert, clip bool, stack []string) error {
+	name := strings.ToLower(ref.Name)
+	if sub, ok := w.models[name]; ok {
+		if inPath(stack, name) {
+			return fmt.Errorf("%w: %s -> %s", ErrRecursive, strings.Join(stack, " -> "), name)
+		}
+		// local colors of sub model override ones of parent
+		sw := *w
+		sw.colors = overlayColors(sub.Colors, w.colors)
+		return sw.walk(sub.Lines, name, matrix, color, invert, clip, sub.Flex == nil, append(append([]string{}, stack...), name))
+	}
+
+	location, err := findSubFileFS(w.p.Library, name)
+	var lines []LdrLine
+	if err == nil && inPath(stack, location) {
+		err = fmt.Errorf("%w: %s -> %s", ErrRecursive, strings.Join(stack, " -> "), location)
+	} else if err == nil {
+		lines, err = w.p.meshLines(w.ctx, location, w.report)
+	}
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return err
+		}
+		kind := ProblemBroken
+		if location == "" {
+			kind = ProblemMissing
+		}
+		return w.report.tolerate(kind, name, &ParseError{File: fileName, Line: ref.Num, Text: ref.Raw, Err: err})
+	}
+	return w.walk(lines, location, matrix, color, invert, clip, false, append(append([]string{}, stack...), location))
+}
+
+// overlayColors local colors of file overriding base, local can be nil
+func overlayColors(local, base *ColorTable) *ColorTable {
+	if local == nil {
+		return base
+	}
+	return local.Overlay(base)
+}
+
+// addTriangle add triangle transformed by matrix, reversed if flip
+func (w *meshWalker) addTriangle(points [3]TransVector, color int, flip, culled bool, matrix *TransMatrix) {
+	if flip && culled {
+		points[1], points[2] = points[2], points[1]
+	}
+	w.mesh.Triangles = append(w.mesh.Triangles, MeshTriangle{
+		Points:   [3]TransVector{matrix.Apply(points[0]), matrix.Apply(points[1]), matrix.Apply(points[2])},
+		Color:    color,
+		TwoSided: !culled,
+	})
+}
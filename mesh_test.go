@@ -0,0 +1,134 @@
+package ldraw
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var meshLibrary = fstest.MapFS{
+	"p/tri.dat":   {Data: []byte("0 BFC CERTIFY CCW\n3 16 0 0 0 1 0 0 0 0 1\n")},
+	"p/cwtri.dat": {Data: []byte("0 BFC CERTIFY CW\n3 16 0 0 0 1 0 0 0 0 1\n")},
+	"p/plain.dat": {Data: []byte("0 not certified\n4 16 0 0 0 1 0 0 1 0 1 0 0 1\n2 24 0 0 0 1 0 0\n5 24 0 0 0 1 0 0 0 0 1 0 0 -1\n")},
+	"parts/part.dat": {Data: []byte("0 BFC CERTIFY CCW\n" +
+		"1 16 0 0 0 1 0 0 0 1 0 0 0 1 tri.dat\n" +
+		"0 BFC INVERTNEXT\n1 4 0 0 0 1 0 0 0 1 0 0 0 1 tri.dat\n" +
+		"1 16 0 0 0 -1 0 0 0 1 0 0 0 1 tri.dat\n" +
+		"1 16 0 0 0 1 0 0 0 1 0 0 0 1 cwtri.dat\n" +
+		"1 16 0 0 0 1 0 0 0 1 0 0 0 1 plain.dat\n" +
+		"0 BFC NOCLIP\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 tri.dat\n")},
+}
+
+func TestMeshDat(t *testing.T) {
+	t.Parallel()
+	colors := NewColorTable()
+	colors.Add(&Color{Name: "Blue", Code: 1, Edge: 0x333333})
+
+	mesh, err := NewParser(&LdrInfo{}, meshLibrary).MeshDat(context.Background(), "parts/part.dat", TranslationMatrix(0, -10, 0), 1, colors, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []MeshTriangle{
+		{Points: [3]TransVector{{0, -10, 0}, {1, -10, 0}, {0, -10, 1}}, Color: 1},
+		{Points: [3]TransVector{{0, -10, 0}, {0, -10, 1}, {1, -10, 0}}, Color: 4},  // INVERTNEXT
+		{Points: [3]TransVector{{0, -10, 0}, {0, -10, 1}, {-1, -10, 0}}, Color: 1}, // mirrored
+		{Points: [3]TransVector{{0, -10, 0}, {0, -10, 1}, {1, -10, 0}}, Color: 1},  // CW
+		{Points: [3]TransVector{{0, -10, 0}, {1, -10, 0}, {1, -10, 1}}, Color: 1, TwoSided: true},
+		{Points: [3]TransVector{{0, -10, 0}, {1, -10, 1}, {0, -10, 1}}, Color: 1, TwoSided: true},
+		{Points: [3]TransVector{{0, -10, 0}, {1, -10, 0}, {0, -10, 1}}, Color: 1, TwoSided: true}, // NOCLIP
+	}
+	if len(mesh.Triangles) != len(want) {
+		t.Fatalf("want %d triangles, got %v", len(want), mesh.Triangles)
+	}
+	for i := range want {
+		if mesh.Triangles[i] != want[i] {
+			t.Errorf("triangle %d: want %v, got %v", i, want[i], mesh.Triangles[i])
+		}
+	}
+
+	if len(mesh.Lines) != 1 || mesh.Lines[0] != (MeshLine{Points: [2]TransVector{{0, -10, 0}, {1, -10, 0}}, Color: 0x2333333}) {
+		t.Errorf("wrong lines: %v", mesh.Lines)
+	}
+	if len(mesh.OptionalLines) != 1 || mesh.OptionalLines[0].Controls[1] != (TransVector{0, -10, -1}) {
+		t.Errorf("wrong optional lines: %v", mesh.OptionalLines)
+	}
+}
+
+func TestMeshModel(t *testing.T) {
+	t.Parallel()
+	content := "0 FILE main.ldr\n1 4 10 0 0 1 0 0 0 1 0 0 0 1 sub.ldr\n" +
+		"0 FILE sub.ldr\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 tri.dat\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 missing.dat\n"
+	parser := NewParser(&LdrInfo{}, meshLibrary)
+
+	mainFile := NewRawFile()
+	if err := parser.ParseLdrReader(strings.NewReader(content), "main.mpd", mainFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.MeshModel(context.Background(), mainFile, nil); !errors.Is(err, ErrSubFileNotFound) {
+		t.Fatalf("want ErrSubFileNotFound, got %v", err)
+	}
+
+	mainFile.Report = &Report{}
+	mesh, err := parser.MeshModel(context.Background(), mainFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// parts in not certified model are still culled
+	want := MeshTriangle{Points: [3]TransVector{{10, 0, 0}, {11, 0, 0}, {10, 0, 1}}, Color: 4}
+	if len(mesh.Triangles) != 1 || mesh.Triangles[0] != want {
+		t.Errorf("want %v, got %v", want, mesh.Triangles)
+	}
+	if problems := mainFile.Report.Problems(); len(problems) != 1 || problems[0].Kind != ProblemMissing || problems[0].Part != "missing.dat" {
+		t.Errorf("wrong problems: %v", problems)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := parser.MeshModel(ctx, mainFile, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("want context.Canceled, got %v", err)
+	}
+}
+
+func TestMeshModelColors(t *testing.T) {
+	t.Parallel()
+	// edge of color 70 of sub model, not of main model, copy hidden by BUFEXCHG is left out
+	content := "0 FILE main.ldr\n0 !COLOUR Main CODE 70 VALUE #FF0000 EDGE #111111\n1 70 0 0 0 1 0 0 0 1 0 0 0 1 sub.ldr\n" +
+		"0 BUFEXCHG A STORE\n1 70 0 0 0 1 0 0 0 1 0 0 0 1 plain.dat\n0 BUFEXCHG A RETRIEVE\n" +
+		"0 FILE sub.ldr\n0 !COLOUR Sub CODE 70 VALUE #00FF00 EDGE #222222\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 plain.dat\n"
+	parser := NewParser(&LdrInfo{}, meshLibrary)
+
+	mainFile := NewRawFile()
+	if err := parser.ParseLdrReader(strings.NewReader(content), "main.mpd", mainFile); err != nil {
+		t.Fatal(err)
+	}
+	mesh, err := parser.MeshModel(context.Background(), mainFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mesh.Lines) != 1 || mesh.Lines[0].Color != 0x2222222 {
+		t.Errorf("wrong lines: %v", mesh.Lines)
+	}
+
+	// model without color table
+	mainFile.Colors = nil
+	if _, err := parser.MeshModel(context.Background(), mainFile, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMeshDatTolerantNotCached(t *testing.T) {
+	t.Parallel()
+	parser := NewParser(&LdrInfo{}, fstest.MapFS{"parts/bad.dat": {Data: []byte("0 bad\n3 16 0 0 0 1 0 0 0 0 1\n3 16 broken\n")}})
+
+	report := &Report{}
+	mesh, err := parser.MeshDat(context.Background(), "parts/bad.dat", InitMatrix, 4, nil, report)
+	if err != nil || len(mesh.Triangles) != 1 || report.Len() != 1 {
+		t.Fatalf("want 1 triangle and 1 problem, got %v %v", report.Problems(), err)
+	}
+	if _, err := parser.MeshDat(context.Background(), "parts/bad.dat", InitMatrix, 4, nil, nil); !errors.Is(err, ErrBadLine) {
+		t.Errorf("want ErrBadLine, got %v", err)
+	}
+}
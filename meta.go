@@ -0,0 +1,147 @@
+package ldraw
+
+import (
+	"strconv"
+	"strings"
+)
+
+// blockState MLCad, LDCad and LPub meta blocks state of one file
+type blockState struct {
+	pliIgnore    bool        // in `0 !LPUB PLI BEGIN IGN`
+	pliSub       *SubfileRef // substitute of `0 !LPUB PLI BEGIN SUB`
+	pliSubPlaced bool        // substitute has position of substituted part
+
+	group      string            // group of next line(s)
+	groupLines int               // lines left of `0 GROUP n name`, -1 for next line only
+	groupNames map[string]string // LDCad group id -> name
+
+	buffers map[string]int // `0 BUFEXCHG` buffer -> count of refs when stored
+	refs    []*SubfileRef  // all refs of file in order
+}
+
+func newBlockState() *blockState {
+	return &blockState{groupNames: map[string]string{}, buffers: map[string]int{}}
+}
+
+// applyMeta apply block meta command, false if not a block meta
+func (bs *blockState) applyMeta(meta *Meta, rf *RawFile) bool {
+	args := meta.Args
+	switch strings.TrimPrefix(meta.Command, "!") {
+	case "LPUB":
+		if len(args) < 2 || args[0] != "PLI" {
+			return false
+		}
+		switch {
+		case args[1] == "BEGIN" && len(args) >= 3 && args[2] == "IGN":
+			bs.pliIgnore = true
+		case args[1] == "BEGIN" && len(args) >= 4 && args[2] == "SUB":
+			// substitute counted once for whole block
+			bs.pliSub, bs.pliSubPlaced = &SubfileRef{LineSource: meta.LineSource, Color: MainColor, Name: args[3], Matrix: [9]float64{1, 0, 0, 0, 1, 0, 0, 0, 1}}, false
+			if len(args) >= 5 {
+				if color, err := parseColorCode(args[4]); err == nil {
+					bs.pliSub.Color = color
+				}
+			}
+		case args[1] == "END":
+			bs.endPLI(rf)
+		default:
+			return false
+		}
+	case "MLCAD":
+		if len(args) < 2 || args[0] != "BTG" {
+			return false
+		}
+		bs.group, bs.groupLines = restFields(meta.Text, 2), -1
+	case "GROUP":
+		// `0 GROUP n name`, n lines belong to group
+		if len(args) < 2 {
+			return false
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return false
+		}
+		bs.group, bs.groupLines = restFields(meta.Text, 2), n
+	case "LDCAD":
+		if len(args) < 1 {
+			return false
+		}
+		params := ldcadParams(restFields(meta.Text, 2))
+		switch args[0] {
+		case "GROUP_DEF":
+			bs.groupNames[params["LID"]] = params["name"]
+		case "GROUP_NXT":
+			// first group id of next line
+			bs.group, bs.groupLines = "", -1
+			if ids := strings.Fields(strings.ReplaceAll(params["ids"], ",", " ")); len(ids) > 0 {
+				bs.group = bs.groupNames[ids[0]]
+			}
+		default:
+			return false
+		}
+	case "BUFEXCHG":
+		if len(args) < 2 {
+			return false
+		}
+		switch args[1] {
+		case "STORE":
+			bs.buffers[args[0]] = len(bs.refs)
+		case "RETRIEVE":
+			// parts added after store are temporary copies
+			if mark, ok := bs.buffers[args[0]]; ok {
+				for _, ref := range bs.refs[mark:] {
+					ref.Ignored, ref.Hidden = true, true
+				}
+			}
+		default:
+			return false
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// endPLI end `0 !LPUB PLI BEGIN` block, substitute is added once
+func (bs *blockState) endPLI(rf *RawFile) {
+	if bs.pliSub != nil {
+		bs.addRef(bs.pliSub, rf)
+	}
+	bs.pliIgnore, bs.pliSub, bs.pliSubPlaced = false, nil, false
+}
+
+// addLine add sub file reference of file line
+func (bs *blockState) addLine(ref *SubfileRef, rf *RawFile) {
+	if bs.groupLines != 0 {
+		ref.Group = bs.group
+		if bs.groupLines--; bs.groupLines < 0 {
+			bs.groupLines = 0
+		}
+	}
+
+	if bs.pliIgnore || bs.pliSub != nil {
+		ref.Ignored = true
+	}
+	if bs.pliSub != nil && !bs.pliSubPlaced {
+		// substitute sits at first substituted part, and use its color if none
+		bs.pliSub.Pos, bs.pliSub.Matrix, bs.pliSubPlaced = ref.Pos, ref.Matrix, true
+		if bs.pliSub.Color == MainColor {
+			bs.pliSub.Color = ref.Color
+		}
+	}
+	bs.addRef(ref, rf)
+}
+
+func (bs *blockState) addRef(ref *SubfileRef, rf *RawFile) {
+	bs.refs = append(bs.refs, ref)
+	rf.addStepRef(ref)
+}
+
+// countParts count parts of file, ignored refs are skipped
+func (bs *blockState) countParts(rf *RawFile) {
+	for _, ref := range bs.refs {
+		if !ref.Ignored {
+			parseInlineFilePart(ref, rf)
+		}
+	}
+}
@@ -15,6 +15,13 @@ type LdrPackPart struct {
 	Color   int
 	X, Y    int
 	W, H, T float64
+
+	Flex *FlexInfo // flexible part, laid straight along x with segments
+
+	Placeholder bool // part not found, a box of W*T*H stands for it
+
+	Matrix *TransMatrix // rotation laying part flat, nil if it stands as modelled
+	center TransVector  // center of bounding box as modelled, for Matrix
 }
 
 func (ldrp *LdrPackPart) CalcSize() (int, int) {
@@ -27,34 +34,172 @@ func (ldrp *LdrPackPart) CalcSize() (int, int) {
 func (ldrp *LdrPackPart) StandLine() string {
 	calcW, calcH := ldrp.CalcSize()
 
-	offsetX := ldrp.X + int(calcW/2) // +x
-	offsetY := -int(ldrp.T / 2)      // -y is upper
-	offSetZ := ldrp.Y + int(calcH/2) // +x
+	// center of spot, part rests on ground: -y is upper
+	spotX := float64(ldrp.X) + float64(calcW)/2
+	spotY := -ldrp.T / 2
+	spotZ := float64(ldrp.Y) + float64(calcH)/2
+
+	if ldrp.Flex != nil {
+		return ldrp.flexLines(calcW, roundInt(spotY), roundInt(spotZ))
+	}
+	if ldrp.Placeholder {
+		// primitive box.dat is 2x2x2
+		return fmt.Sprintf("0 // placeholder of %s\n1 %d %d %d %d %s %s %s %s\n", ldrp.Name, ldrp.Color, roundInt(spotX), roundInt(spotY), roundInt(spotZ),
+			formatFloats(ldrp.W/2, 0, 0), formatFloats(0, ldrp.T/2, 0), formatFloats(0, 0, ldrp.H/2), PlaceholderPart)
+	}
+
+	// center of bounding box, rotated or as modelled, on center of spot
+	rotation, matrix := DefaultXMatrix, InitMatrix
+	if ldrp.Matrix != nil {
+		rotation, matrix = rotationString(ldrp.Matrix), ldrp.Matrix
+	}
+	c := matrix.Apply(ldrp.center)
+	return fmt.Sprintf("1 %d %d %d %d %s %s\n", ldrp.Color,
+		roundInt(spotX-c[0]), roundInt(spotY-c[1]), roundInt(spotZ-c[2]), rotation, ldrp.Name)
+}
+
+// roundInt v rounded to nearest int
+func roundInt(v float64) int {
+	return int(math.Round(v))
+}
+
+// restOrientations rotations resting bounding box on each of its six faces,
+// as modelled first
+var restOrientations = []*TransMatrix{
+	InitMatrix,
+	{0, 1, 0, 0, -1, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1},  // +90 around z
+	{0, -1, 0, 0, 1, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1},  // -90 around z
+	{1, 0, 0, 0, 0, 0, 1, 0, 0, -1, 0, 0, 0, 0, 0, 1},  // +90 around x
+	{1, 0, 0, 0, 0, 0, -1, 0, 0, 1, 0, 0, 0, 0, 0, 1},  // -90 around x
+	{1, 0, 0, 0, 0, -1, 0, 0, 0, 0, -1, 0, 0, 0, 0, 1}, // 180 around x
+}
+
+// layFlat rotation resting part of bounding box b on its largest face, so
+// it is lowest, and size of rotated box. Nil rotation if part is lowest as
+// modelled, ties keep earlier orientation.
+func layFlat(b [2][3]float64) (*TransMatrix, [3]float64) {
+	box := &BoundingBox{Min: b[0], Max: b[1]}
 
-	return fmt.Sprintf("1 %d %d %d %d %s %s\n", ldrp.Color, offsetX, offsetY, offSetZ, DefaultXMatrix, ldrp.Name)
+	var best *TransMatrix
+	bestSize := box.CalcSize()
+	for _, m := range restOrientations[1:] {
+		if size := box.Transform(m).CalcSize(); size[1] < bestSize[1]-1e-6 {
+			best, bestSize = m, size
+		}
+	}
+	return best, bestSize
 }
 
+// flexLines straight flexible part, segments one by one along x
+func (ldrp *LdrPackPart) flexLines(calcW, offsetY, offSetZ int) string {
+	rotation := rotationString(rotationBetween(ldrp.Flex.Axis, TransVector{1, 0, 0}))
+	pitch := ldrp.W / float64(ldrp.Flex.Segments)
+	startX := float64(ldrp.X) + (float64(calcW)-ldrp.W)/2 + pitch/2
+
+	lines := ""
+	for i := 0; i < ldrp.Flex.Segments; i++ {
+		offsetX := int(math.Round(startX + float64(i)*pitch))
+		lines += fmt.Sprintf("1 %d %d %d %d %s %s\n", ldrp.Color, offsetX, offsetY, offSetZ, rotation, ldrp.Name)
+	}
+	return lines
+}
+
+// rotationString `a b c d e f g h i` of matrix, rounded
+func rotationString(m *TransMatrix) string {
+	vs := []float64{m[0], m[4], m[8], m[1], m[5], m[9], m[2], m[6], m[10]}
+	for i := range vs {
+		vs[i] = math.Round(vs[i]*1e6) / 1e6
+	}
+	return formatFloats(vs...)
+}
+
+// newFlexPackPart straight flexible part, size from segment rotated along x
+func newFlexPackPart(one *Part, segment [2][3]float64) *LdrPackPart {
+	bb := NewBoundingBox()
+	corners := boxCorners(segment)
+	bb.MergeTransformed(rotationBetween(one.Flex.Axis, TransVector{1, 0, 0}), corners[:]...)
+	size := bb.CalcSize()
+
+	return &LdrPackPart{
+		Name: one.Flex.Segment, Color: one.Color,
+		X: 0, Y: 0,
+		W: one.Flex.Length, H: size[2], T: size[1],
+		Flex: one.Flex,
+	}
+}
+
+// PlaceholderPart primitive standing for not found parts in tolerant mode
+const PlaceholderPart = `box.dat`
+
+// placeholderSize size of placeholder, a 1x1 brick
+var placeholderSize = [2][3]float64{{-10, -24, -10}, {10, 0, 10}}
+
 type LdrBinPack []*LdrPackPart
 
-// NewPackParts NewPackParts
-func NewPackParts(partMap map[string]*Part) *LdrBinPack {
+// NewPackParts NewPackParts, custom parts are looked up by part id
+func NewPackParts(partMap map[string]*Part, customParts ...map[string][2][3]float64) *LdrBinPack {
+	return NewPackPartsReport(partMap, nil, customParts...)
+}
+
+// NewPackPartsReport NewPackParts in tolerant mode if report is set, not found
+// parts are recorded in report and a placeholder box is packed for each
+func NewPackPartsReport(partMap map[string]*Part, report *Report, customParts ...map[string][2][3]float64) *LdrBinPack {
+	return newPackParts(EmbeddedInfo(), partMap, report, customParts...)
+}
+
+func newPackParts(info *LdrInfo, partMap map[string]*Part, report *Report, customParts ...map[string][2][3]float64) *LdrBinPack {
 	parts := LdrBinPack{}
 	for _, one := range partMap {
 		// ignore none offical part
 		name := one.ID + ".dat"
-		v, ok := AllParts[name]
+		if one.Flex != nil {
+			name = one.Flex.Segment
+		}
+		v, ok := info.Parts[name]
+		for i := 0; !ok && i < len(customParts); i++ {
+			if one.Flex == nil {
+				name = one.ID
+			}
+			v, ok = customParts[i][name]
+		}
+		if !ok && report != nil {
+			report.Add(ProblemMissing, name, fmt.Errorf("%w: %s", ErrSubFileNotFound, name))
+
+			w, h, t := GetBoxWHTByX(placeholderSize)
+			for i := 0; i < one.Count; i++ {
+				parts = append(parts, &LdrPackPart{
+					Name: name, Color: one.Color,
+					W: w, H: h, T: t,
+					Placeholder: true,
+				})
+			}
+			continue
+		}
 		if !ok {
 			log.Printf("brick not found: %s\n", name)
 			continue
 		}
 
+		if one.Flex != nil && one.Flex.Segments > 0 {
+			for i := 0; i < one.Count; i++ {
+				parts = append(parts, newFlexPackPart(one, v))
+			}
+			continue
+		}
+
 		w, h, t := GetBoxWHTByX(v)
+		m, size := layFlat(v)
+		if m != nil {
+			w, h, t = size[0], size[2], size[1]
+		}
+		center := TransVector{(v[0][0] + v[1][0]) / 2, (v[0][1] + v[1][1]) / 2, (v[0][2] + v[1][2]) / 2}
 
 		for i := 0; i < one.Count; i++ {
 			parts = append(parts, &LdrPackPart{
 				Name: name, Color: one.Color,
 				X: 0, Y: 0,
 				W: w, H: h, T: t,
+				Matrix: m, center: center,
 			})
 		}
 	}
@@ -91,6 +236,45 @@ func (lbp *LdrBinPack) Save(fileName string) {
 	outputW, outputH := binpack.Pack(lbp)
 	fmt.Printf("output: %dx%d\n", outputH, outputW)
 
+	saveTray(fileName, []*LdrBinPack{lbp}, false)
+}
+
+// LdrStepPack one pack per building step
+type LdrStepPack []*LdrBinPack
+
+// NewStepPackParts NewStepPackParts, empty steps are skipped
+func NewStepPackParts(steps []map[string]*Part, customParts ...map[string][2][3]float64) LdrStepPack {
+	return NewStepPackPartsReport(steps, nil, customParts...)
+}
+
+// NewStepPackPartsReport NewStepPackParts in tolerant mode if report is set, see NewPackPartsReport
+func NewStepPackPartsReport(steps []map[string]*Part, report *Report, customParts ...map[string][2][3]float64) LdrStepPack {
+	return NewParser(nil, nil).StepPackParts(steps, report, customParts...)
+}
+
+// stepSpacing spacing between step trays
+const stepSpacing = 80
+
+// Save pack each step and lay them one after another
+func (lsp LdrStepPack) Save(fileName string) {
+	outputW, outputH := 0, 0
+	for _, lbp := range lsp {
+		w, h := binpack.Pack(lbp)
+		for _, one := range *lbp {
+			one.Y += outputH
+		}
+
+		if w > outputW {
+			outputW = w
+		}
+		outputH += h + stepSpacing
+	}
+	fmt.Printf("output: %dx%d\n", outputH, outputW)
+
+	saveTray(fileName, lsp, true)
+}
+
+func saveTray(fileName string, packs []*LdrBinPack, withStep bool) {
 	var wf *os.File
 	var err error
 	if wf, err = os.Create(fileName); err != nil {
@@ -98,16 +282,29 @@ func (lbp *LdrBinPack) Save(fileName string) {
 	}
 	defer wf.Close()
 
+	total := 0
+	for _, lbp := range packs {
+		total += lbp.Len()
+	}
+
 	if _, err := wf.WriteString(defaultLDrGroundHeader); err != nil {
 		log.Fatal(err)
 	}
-	if _, err := wf.WriteString(fmt.Sprintf("0 NumOfBricks:  %d\n", len(*lbp))); err != nil {
+	if _, err := wf.WriteString(fmt.Sprintf("0 NumOfBricks:  %d\n", total)); err != nil {
 		log.Fatal(err)
 	}
 
-	for _, one := range *lbp {
-		if _, err := wf.WriteString(one.StandLine()); err != nil {
-			log.Fatal(err)
+	for _, lbp := range packs {
+		for _, one := range *lbp {
+			if _, err := wf.WriteString(one.StandLine()); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if withStep {
+			if _, err := wf.WriteString("0 STEP\n"); err != nil {
+				log.Fatal(err)
+			}
 		}
 	}
 
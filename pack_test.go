@@ -0,0 +1,45 @@
+package ldraw
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPackPartsLayFlat(t *testing.T) {
+	t.Parallel()
+	parser := NewParser(&LdrInfo{Parts: map[string][2][3]float64{
+		"3001.dat":  {{-40, -4, -20}, {40, 24, 20}},  // 2x4 brick, flat already
+		"2454.dat":  {{-10, -4, -10}, {10, 120, 10}}, // 1x1x5 brick
+		"panel.dat": {{-20, -4, -2}, {20, 40, 2}},    // thin panel standing
+	}}, nil)
+	parts := parser.PackParts(map[string]*Part{
+		"3001-4":  {ID: "3001", Color: 4, Count: 1},
+		"2454-1":  {ID: "2454", Color: 1, Count: 1},
+		"panel-2": {ID: "panel", Color: 2, Count: 1},
+	}, nil)
+
+	want := map[string][3]float64{"3001.dat": {80, 40, 28}, "2454.dat": {124, 20, 20}, "panel.dat": {40, 44, 4}}
+	for _, one := range *parts {
+		size := [3]float64{one.W, one.H, one.T}
+		if size != want[one.Name] {
+			t.Errorf("%s: want %v, got %v", one.Name, want[one.Name], size)
+		}
+		if (one.Matrix == nil) != (one.Name == "3001.dat") {
+			t.Errorf("%s: wrong matrix %v", one.Name, one.Matrix)
+		}
+
+		// part rests on ground in center of its spot
+		lines, err := ParseLines(strings.NewReader(one.StandLine()), "tray.ldr")
+		if err != nil || len(lines) != 1 {
+			t.Fatalf("%s: wrong line %q: %v", one.Name, one.StandLine(), err)
+		}
+		ref := lines[0].(*SubfileRef)
+		b := parser.info().Parts[one.Name]
+		box := (&BoundingBox{Min: b[0], Max: b[1]}).Transform(ref.TransMatrix())
+		w, h := one.CalcSize()
+		if box.Max[1] != 0 || box.Min[1] != -one.T ||
+			box.Min[0]+box.Max[0] != float64(2*one.X+w) || box.Min[2]+box.Max[2] != float64(2*one.Y+h) {
+			t.Errorf("%s: wrong place %v %v of %q", one.Name, box.Min, box.Max, one.StandLine())
+		}
+	}
+}
@@ -1,243 +1,544 @@
 package ldraw
 
 import (
-	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"os"
-	"strconv"
+	"runtime"
 	"strings"
 	"sync"
 )
 
-var (
-	parsedFile sync.Map
-	pLock      sync.Mutex
-)
-
-// ParseDatFile ParseDatFile
+// ParseDatFile ParseDatFile, fatal on error
 func ParseDatFile(fileName string, matrix *TransMatrix, ldrawRoot string) *BoundingBox {
-	resp := NewBoundingBox()
-
-	// sync.Map parse sub file once
-	if got, ok := parsedFile.Load(fileName); ok {
-		bb := got.(*BoundingBox)
-		// transform to new bounding box
-		resp.MergeMinMaxVector(MultipleVector(matrix, bb.Min, bb.Max)...)
-
-		return resp
+	bb, err := ParseDatBoundingBox(fileName, matrix, ldrawRoot)
+	if err != nil {
+		log.Fatal(err)
 	}
+	return bb
+}
 
+// ParseDatBoundingBox parse dat file and all sub files into bounding box,
+// parsed sub files are shared by calls with same ldrawRoot
+func ParseDatBoundingBox(fileName string, matrix *TransMatrix, ldrawRoot string) (*BoundingBox, error) {
 	oneReader, errF := os.Open(fileName)
 	if errF != nil {
-		log.Fatalf("Open ldr file failed: %v.\n", errF)
+		return nil, &ParseError{File: fileName, Err: errF}
 	}
 	defer oneReader.Close()
 
-	lineNum := 0
-	// start reading from the file with a reader.
-	reader := bufio.NewReader(oneReader)
-	var line string
-	var err error
-	for {
-		lineNum++
-
-		line, err = reader.ReadString('\n')
-		if err != nil && err != io.EOF {
-			break
+	return rootParser(ldrawRoot).ParseDatReader(oneReader, fileName, matrix)
+}
+
+// ParseDatFS parse dat file in ldraw library fs into bounding box
+func ParseDatFS(lib fs.FS, fileName string, matrix *TransMatrix) (*BoundingBox, error) {
+	return NewParser(nil, lib).ParseDatFS(fileName, matrix)
+}
+
+// ParseDatFSTolerant parse dat file like ParseDatFS, missing or broken sub
+// files and lines are left out of bounding box and recorded in report
+func ParseDatFSTolerant(lib fs.FS, fileName string, matrix *TransMatrix, report *Report) (*BoundingBox, error) {
+	return NewParser(nil, lib).ParseDatFSTolerant(fileName, matrix, report)
+}
+
+// ParseDatReader parse dat content, sub files are searched in ldraw library fs
+func ParseDatReader(r io.Reader, fileName string, matrix *TransMatrix, lib fs.FS) (*BoundingBox, error) {
+	return NewParser(nil, lib).ParseDatReader(r, fileName, matrix)
+}
+
+// datCall parse of one library file, waited by all who need it
+type datCall struct {
+	done  chan struct{}
+	bb    *BoundingBox
+	err   error
+	clean bool // no problems in file and its sub files
+
+	stack []string         // files from top file down to this one, for recursion
+	deps  map[*datCall]int // calls parsing sub files of this one, guarded by Parser.l
+}
+
+// topCall call of file parsed by caller of Parser, none waits for it
+func topCall(fileName string) *datCall {
+	return &datCall{stack: []string{fileName}, deps: map[*datCall]int{}}
+}
+
+// datKey library file parsed strict or tolerant, tolerant result without
+// problems equals strict one
+type datKey struct {
+	file     string
+	tolerant bool
+}
+
+// loadDat bounding box of library file, each file is parsed once even if
+// asked concurrently. caller is call of file referencing it.
+func (p *Parser) loadDat(ctx context.Context, fileName string, report *Report, caller *datCall) (*BoundingBox, error) {
+	if got, ok := p.parsed.Load(fileName); ok {
+		return got.(*BoundingBox), nil
+	}
+	if inPath(caller.stack, fileName) {
+		return nil, fmt.Errorf("%w: %s -> %s", ErrRecursive, strings.Join(caller.stack, " -> "), fileName)
+	}
+
+	key := datKey{file: fileName, tolerant: report != nil}
+	p.l.Lock()
+	if c, ok := p.calls[key]; ok {
+		// parsing by others, files referencing each other from different
+		// parents would wait for each other forever
+		if p.waits(c, caller) {
+			p.l.Unlock()
+			return nil, fmt.Errorf("%w: %s -> %s, which is parsing %s", ErrRecursive, strings.Join(caller.stack, " -> "), fileName, strings.Join(c.stack, " -> "))
 		}
+		caller.deps[c]++
+		p.l.Unlock()
+		defer p.endWait(caller, c)
+
+		select {
+		case <-c.done:
+			if !c.clean {
+				report.taint()
+			}
+			return c.bb, c.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if p.calls == nil {
+		p.calls = map[datKey]*datCall{}
+	}
+	c := &datCall{done: make(chan struct{}), stack: append(append([]string{}, caller.stack...), fileName), deps: map[*datCall]int{}}
+	p.calls[key] = c
+	caller.deps[c]++
+	p.l.Unlock()
+
+	// only boxes without problems are shared, others miss parts of file
+	own := report.child()
+	c.bb, c.err = p.parseDatFS(ctx, fileName, InitMatrix, own, c)
+	c.clean = own.clean()
+	if !c.clean {
+		report.taint()
+	}
+	if c.err == nil && c.clean {
+		p.parsed.Store(fileName, c.bb)
+	}
+
+	p.l.Lock()
+	delete(p.calls, key)
+	p.l.Unlock()
+	p.endWait(caller, c)
+	close(c.done)
+	return c.bb, c.err
+}
 
-		line = strings.TrimSpace(strings.ReplaceAll(line, "\r\n", ""))
-		if line == "" {
-			if err != nil {
-				// fail break all
-				break
+// waits true if call from waits for call to, directly or by calls it waits
+// for. p.l is held.
+func (p *Parser) waits(from, to *datCall) bool {
+	seen := map[*datCall]bool{}
+	next := []*datCall{from}
+	for len(next) > 0 {
+		c := next[len(next)-1]
+		next = next[:len(next)-1]
+		if c == to {
+			return true
+		}
+		for dep := range c.deps {
+			if !seen[dep] {
+				seen[dep] = true
+				next = append(next, dep)
 			}
+		}
+	}
+	return false
+}
+
+// endWait caller does not wait for c any more
+func (p *Parser) endWait(caller, c *datCall) {
+	p.l.Lock()
+	if caller.deps[c]--; caller.deps[c] <= 0 {
+		delete(caller.deps, c)
+	}
+	p.l.Unlock()
+}
+
+// parseDatFS parse library file with matrix
+func (p *Parser) parseDatFS(ctx context.Context, fileName string, matrix *TransMatrix, report *Report, caller *datCall) (*BoundingBox, error) {
+	own := report.child()
+	lines, err := p.readLibraryDat(ctx, fileName, own)
+	if err != nil {
+		return nil, err
+	}
+	return p.parseDatLines(ctx, lines, fileName, matrix, own, caller)
+}
+
+// readLibraryDat read lines of library file, kept for Exact mode if
+// without problems
+func (p *Parser) readLibraryDat(ctx context.Context, fileName string, report *Report) ([]LdrLine, error) {
+	if p.Library == nil {
+		return nil, &ParseError{File: fileName, Err: fs.ErrNotExist}
+	}
+
+	lines, err := p.readDat(ctx, fileName, func() (io.ReadCloser, error) { return p.Library.Open(fileName) }, report)
+	if err != nil {
+		return nil, err
+	}
+	if p.Exact && report.clean() {
+		p.lines.Store(fileName, lines)
+	}
+	return lines, nil
+}
+
+// readDat read lines of file, at most Workers files are read at once
+func (p *Parser) readDat(ctx context.Context, fileName string, open func() (io.ReadCloser, error), report *Report) ([]LdrLine, error) {
+	p.semOnce.Do(func() {
+		workers := p.Workers
+		if workers <= 0 {
+			workers = runtime.NumCPU()
+		}
+		p.sem = make(chan struct{}, workers)
+	})
+
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-p.sem }()
+
+	oneReader, errF := open()
+	if errF != nil {
+		return nil, &ParseError{File: fileName, Err: errF}
+	}
+	defer oneReader.Close()
+
+	return parseLines(oneReader, fileName, report)
+}
+
+// parseDatLines bounding box of lines with matrix, sub files are parsed in
+// parallel by calls waited by caller
+func (p *Parser) parseDatLines(ctx context.Context, lines []LdrLine, fileName string, matrix *TransMatrix, report *Report, caller *datCall) (*BoundingBox, error) {
+	type subFile struct {
+		location string
+		bb       *BoundingBox
+		err      error
+	}
+
+	// resolve and parse each sub file once, waiting holds no worker
+	subs := map[string]*subFile{}
+	var wg sync.WaitGroup
+	for _, one := range lines {
+		l, ok := one.(*SubfileRef)
+		if !ok {
+			continue
+		}
+		//cast all to lower
+		name := strings.ToLower(l.Name)
+		if _, ok := subs[name]; ok {
 			continue
 		}
 
-		values := parseOneLine(line)
-		if len(values) == 0 {
-			log.Fatalf("file %s wrong line %d: %q\n", fileName, lineNum, line)
+		sub := &subFile{}
+		subs[name] = sub
+		if sub.location, sub.err = findSubFileFS(p.Library, name); sub.err != nil {
+			continue
 		}
 
-		if values[0] == "1" {
-			if len(values) < 15 {
-				continue
-			} else if len(values) > 15 {
-				// as file name can contain space, join together
-				values[14] = strings.Join(values[14:], " ")
-			}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sub.bb, sub.err = p.loadDat(ctx, sub.location, report, caller)
+		}()
+	}
+	wg.Wait()
 
-			//cast all to lower
-			values[14] = strings.ToLower(values[14])
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-			fileRealLocation := getSubFileRealLocation(values[14], ldrawRoot)
-			subFileBoundingBox := ParseDatFile(fileRealLocation, InitMatrix, ldrawRoot)
-			parsedFile.Store(fileRealLocation, subFileBoundingBox)
+	resp := NewBoundingBox()
+	for _, one := range lines {
+		switch l := one.(type) {
+		case *SubfileRef:
+			name := strings.ToLower(l.Name)
+			sub := subs[name]
+			if sub.err != nil {
+				if errors.Is(sub.err, context.Canceled) || errors.Is(sub.err, context.DeadlineExceeded) {
+					return nil, sub.err
+				}
+
+				kind := ProblemBroken
+				if sub.location == "" {
+					kind = ProblemMissing
+				}
+				if err := report.tolerate(kind, name, &ParseError{File: fileName, Line: l.Num, Text: l.Raw, Err: sub.err}); err != nil {
+					return nil, err
+				}
+				continue
+			}
 
 			// calc all parent matrix
-			subFileMatrix := NewTransMatrixFromStrs(values[2:14])
-			subFileMatrixMulti := MultipleMatrix(matrix, subFileMatrix)
+			subFileMatrixMulti := matrix.Mul(l.TransMatrix())
 
 			// apply to sub file bouding-box
-			subFileVectorMulti := MultipleVector(subFileMatrixMulti, subFileBoundingBox.Min, subFileBoundingBox.Max)
-
-			resp.MergeMinMaxVector(subFileVectorMulti...)
-
-		} else if values[0] == "2" {
-			vectors := NewVectorsFromLine(values[2:8], 2)
-			resp.MergeMinMaxVector(MultipleVector(matrix, vectors...)...)
-		} else if values[0] == "3" {
-			vectors := NewVectorsFromLine(values[2:11], 3)
-			resp.MergeMinMaxVector(MultipleVector(matrix, vectors...)...)
-		} else if values[0] == "4" {
-			vectors := NewVectorsFromLine(values[2:14], 4)
-			resp.MergeMinMaxVector(MultipleVector(matrix, vectors...)...)
+			if err := p.mergeDat(ctx, resp, sub.location, sub.bb, &subFileMatrixMulti, caller.stack); err != nil {
+				return nil, err
+			}
+		case *Line:
+			resp.MergeTransformed(matrix, l.Points[:]...)
+		case *Triangle:
+			resp.MergeTransformed(matrix, l.Points[:]...)
+		case *Quad:
+			resp.MergeTransformed(matrix, l.Points[:]...)
 		}
 		// currently do not need parse type "5"
+	}
 
-		if err != nil && err == io.EOF {
-			break
-		}
+	return resp.TransEmpty(), nil
+}
+
+// maxExactDepth deepest sub file whose vertices are transformed in Exact
+// mode, deeper ones merge their transformed boxes
+const maxExactDepth = 8
+
+// mergeDat merge library file with bounding box bb transformed by matrix into
+// resp. Corners of bb are exact unless matrix rotates off axis in Exact mode,
+// then vertices of file are transformed. path is files merging this one,
+// references back to them are left out.
+func (p *Parser) mergeDat(ctx context.Context, resp *BoundingBox, fileName string, bb *BoundingBox, matrix *TransMatrix, path []string) error {
+	got, ok := p.lines.Load(fileName)
+	if !p.Exact || !ok || matrix.axisAligned() || len(path) >= maxExactDepth {
+		resp.MergeBox(matrix, bb)
+		return nil
 	}
-	if err != io.EOF {
-		log.Fatalf("Parse file failed with error: %s\n", err)
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	return resp.TransEmpty()
+	path = append(path[:len(path):len(path)], fileName)
+	for _, one := range got.([]LdrLine) {
+		switch l := one.(type) {
+		case *SubfileRef:
+			location, err := findSubFileFS(p.Library, strings.ToLower(l.Name))
+			if err != nil || inPath(path, location) {
+				// left out and reported while parsing file
+				continue
+			}
+			sub, ok := p.parsed.Load(location)
+			if !ok {
+				continue
+			}
+			subMatrix := matrix.Mul(l.TransMatrix())
+			if err := p.mergeDat(ctx, resp, location, sub.(*BoundingBox), &subMatrix, path); err != nil {
+				return err
+			}
+		case *Line:
+			resp.MergeTransformed(matrix, l.Points[:]...)
+		case *Triangle:
+			resp.MergeTransformed(matrix, l.Points[:]...)
+		case *Quad:
+			resp.MergeTransformed(matrix, l.Points[:]...)
+		}
+	}
+	return nil
 }
 
-// ParseLdrContent ParseLdrContent
+// ParseLdrContent ParseLdrContent, fatal on error
 func ParseLdrContent(fileName string, mainFile *RawFile) {
+	if err := ParseLdrFile(fileName, mainFile); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// ParseLdrFile parse ldr/mpd file into mainFile
+func ParseLdrFile(fileName string, mainFile *RawFile) error {
 	oneReader, errF := os.Open(fileName)
 	if errF != nil {
-		log.Fatalf("Open ldr file failed: %v.\n", errF)
+		return &ParseError{File: fileName, Err: errF}
 	}
 	defer oneReader.Close()
-	// Start reading from the file with a reader.
-	reader := bufio.NewReader(oneReader)
-
-	isFirstFile := true
-	lfNum := 1
-	lineNum := 1
-	workingFileName := ""
-
-	var line string
-	var err error
-	for {
-		lineNum++
-
-		line, err = reader.ReadString('\n')
-		if err != nil && err != io.EOF {
-			break
-		}
 
-		line = strings.TrimSpace(strings.ReplaceAll(line, "\r\n", ""))
-		if line == "" {
-			if err != nil {
-				// fail break all
-				break
-			}
-			continue
-		}
+	return ParseLdrReader(oneReader, fileName, mainFile)
+}
 
-		values := parseOneLine(line)
-		if len(values) == 0 {
-			log.Fatalf("file %s wrong line %d: %q\n", fileName, lineNum, line)
-		}
+// ParseLdrFS parse ldr/mpd file in fs into mainFile
+func ParseLdrFS(fsys fs.FS, fileName string, mainFile *RawFile) error {
+	oneReader, errF := fsys.Open(fileName)
+	if errF != nil {
+		return &ParseError{File: fileName, Err: errF}
+	}
+	defer oneReader.Close()
 
-		if lfNum == 1 {
-			// remove optional utf8-bom
-			if len(values[0]) != 1 {
-				values[0] = values[0][len(values[0])-1:]
-			}
+	return ParseLdrReader(oneReader, fileName, mainFile)
+}
 
-			if len(values) < 2 || values[0] != `0` {
-				log.Fatalf("parse line fail: %s", line)
-			}
+// ParseLdrReader parse ldr/mpd content into mainFile, fileName is used for errors.
+// Every `0 FILE` starts a new sub file, the first one before any model line is
+// main model, `0 NOFILE` is optional.
+// Bad lines are recorded if mainFile.Report is set, they and lines ldraw
+// viewers skip are kept as raw lines.
+func ParseLdrReader(r io.Reader, fileName string, mainFile *RawFile) error {
+	lines, err := parseLines(r, fileName, mainFile.Report)
+	if err != nil {
+		return err
+	}
 
-			if values[1] == "FILE" && len(values) >= 3 {
-				// contains sub file, mpd?
-				workingFileName = strings.Join(values[2:], " ")
-			} else {
-				workingFileName = strings.Join(values[1:], " ")
-			}
-			workingFileName = strings.ToLower(workingFileName)
+	workingFile := mainFile
+	target := &mainFile.Lines // lines of working file or data file
+	var dataFile *DataFile
+	var dataPayload []string
+	isClosed := false // after `0 NOFILE`
+	isMPD := false
+	hasSection := false // `0 FILE` or `0 !DATA` seen
+	hasModel := false   // model lines before first section
+	blocks := map[*RawFile]*blockState{mainFile: newBlockState()}
+
+	i := -1 // index of typed line
+	for _, one := range lines {
+		if one.LineType() < 0 {
+			// raw lines are only written back
+			*target = append(*target, one)
+			continue
+		}
+		i++
 
-			if isFirstFile {
+		meta, isMeta := one.(*Meta)
+		if isMeta && (meta.Command == "FILE" || meta.Command == "!DATA") && len(meta.Args) > 0 {
+			if err := mainFile.decodeDataFile(fileName, dataFile, dataPayload); err != nil {
+				return err
+			}
+			dataFile, dataPayload, isClosed = nil, nil, false
+
+			// contains sub file, mpd
+			workingFileName := strings.ToLower(restFields(meta.Text, 1))
+			if meta.Command == "!DATA" {
+				dataFile = &DataFile{Name: workingFileName}
+				mainFile.DataFiles[workingFileName] = dataFile
+				mainFile.SubFileOrder = append(mainFile.SubFileOrder, workingFileName)
+				target = &dataFile.Lines
+			} else if !hasSection && !hasModel {
+				// leading comments and empty lines belong to main model
 				mainFile.Name = workingFileName
+				isMPD = true
 			} else {
 				// is inline sub-file
-				mainFile.SubFiles[workingFileName] = NewRawFile()
+				workingFile = NewRawFile()
+				workingFile.info = mainFile.info
+				workingFile.Name = workingFileName
+				mainFile.SubFiles[workingFileName] = workingFile
+				blocks[workingFile] = newBlockState()
+				mainFile.SubFileOrder = append(mainFile.SubFileOrder, workingFileName)
+				target = &workingFile.Lines
 			}
-
-			lfNum++
+			hasSection = true
+			*target = append(*target, one)
 			continue
 		}
 
-		if values[0] == "0" && values[1] == "NOFILE" {
-			// main file end, start parse all files
-			isFirstFile = false
-			workingFileName = ""
+		*target = append(*target, one)
+		if !hasSection && one.LineType() > 0 {
+			hasModel = true
+		}
 
-			lfNum = 1 // reset inline file numer
+		if i == 0 && one.LineType() == 0 {
+			// none mpd file, title as name
+			if isMeta {
+				mainFile.Name = strings.ToLower(meta.Text)
+			}
 			continue
+		} else if i == 0 {
+			// tolerant mode keeps first line as model content
+			errF := &ParseError{File: fileName, Line: one.LineNum(), Text: one.LineText(), Err: ErrBadLine}
+			if err := mainFile.Report.tolerate(ProblemBroken, fileName, errF); err != nil {
+				return err
+			}
 		}
 
-		// TODO: custom hose?
+		if isClosed {
+			// lines between `0 NOFILE` and next `0 FILE` are ignored
+			continue
+		}
 
-		// other command push lines to data
-		if isFirstFile {
-			parseInlineFilePart(values, mainFile)
-		} else {
-			parseInlineFilePart(values, mainFile.SubFiles[workingFileName])
+		if isMeta && meta.Command == "NOFILE" {
+			isClosed = true
+			continue
 		}
 
-		lfNum++
-	}
-	if err != io.EOF {
-		log.Fatalf("Parse file failed with error: %s\n", err)
-	}
-}
+		if dataFile != nil {
+			if isMeta && meta.Command == "!:" {
+				dataPayload = append(dataPayload, meta.Args...)
+			}
+			continue
+		}
 
-func parseInlineFilePart(v []string, target *RawFile) {
-	if v[0] == "1" {
-		if len(v) < 15 {
-			return
-		} else if len(v) > 15 {
-			// as file name can contain space, join together
-			v[14] = strings.Join(v[14:], " ")
+		if isMeta && meta.Command == "!COLOUR" {
+			if err := workingFile.Colors.addColorLine(fileName, meta); err != nil && mainFile.Report != nil {
+				// colors are only looked up, bad definition is skipped
+				mainFile.Report.Add(ProblemBroken, fileName, err)
+			}
+			continue
 		}
 
-		//cast all to lower
-		v[14] = strings.ToLower(v[14])
+		if isMeta && (meta.Command == "STEP" || meta.Command == "ROTSTEP") {
+			workingFile.endStep(meta)
+			continue
+		}
 
-		// in ldraw p(sub) dir do not parse
-		if _, ok := AllP[v[14]]; ok {
-			return
+		if isMeta && blocks[workingFile].applyMeta(meta, workingFile) {
+			continue
 		}
 
-		// in ldraw parts list
-		var id string
-		if _, ok := AllParts[v[14]]; ok {
-			id = v[14][:len(v[14])-4]
-		} else {
-			// inline sub file or custom parts
-			id = v[14]
+		if ref, ok := one.(*SubfileRef); ok {
+			blocks[workingFile].addLine(ref, workingFile)
 		}
+	}
 
-		k := id + "-" + v[1]
+	// count sub file references, after BUFEXCHG may hide former parts
+	for rf, bs := range blocks {
+		// PLI block left open till end of file
+		bs.endPLI(rf)
+		bs.countParts(rf)
+	}
 
-		pLock.Lock()
-		if fp, ok := target.Parts[k]; ok {
-			fp.Count++
-		} else {
-			colorInt, _ := strconv.Atoi(v[1])
-			target.Parts[k] = &Part{ID: id, Color: colorInt, Count: 1}
-		}
-		pLock.Unlock()
+	if err := mainFile.decodeDataFile(fileName, dataFile, dataPayload); err != nil {
+		return err
 	}
+
+	mainFile.Header = ParseHeader(mainFile.Lines)
+	if !isMPD && mainFile.Header.Name != "" {
+		// none mpd file, prefer `0 Name:` to title
+		mainFile.Name = strings.ToLower(mainFile.Header.Name)
+	}
+	for _, sub := range mainFile.SubFiles {
+		sub.Header = ParseHeader(sub.Lines)
+		// LDCad hose, cable and band
+		sub.Flex = detectFlex(sub)
+	}
+	return nil
+}
+
+// decodeDataFile decode base64 payload of `0 !:` lines
+func (rf *RawFile) decodeDataFile(fileName string, dataFile *DataFile, payload []string) error {
+	if dataFile == nil {
+		return nil
+	}
+
+	content, err := base64.StdEncoding.DecodeString(strings.Join(payload, ""))
+	if err != nil {
+		return rf.Report.tolerate(ProblemBroken, dataFile.Name, &ParseError{File: fileName, Line: dataFile.Lines[0].LineNum(), Text: dataFile.Lines[0].LineText(), Err: err})
+	}
+	dataFile.Content = content
+	return nil
+}
+
+func parseInlineFilePart(ref *SubfileRef, target *RawFile) {
+	id, orig, ok := target.partInfo().refPartID(ref)
+	if !ok {
+		return
+	}
+	addPartCount(target.Parts, id, ref.Color, 1).addOrigIDs(orig)
 }
 
 // parseOneLine parse line to command(s)
@@ -247,31 +548,34 @@ func parseOneLine(line string) []string {
 	return strings.Fields(lineClean)
 }
 
+// ReplaceSubFiles parts of file with inline sub files expanded, each sub file
+// part is counted once per placement of sub file
 func ReplaceSubFiles(rawFile *RawFile, subFiles *map[string]*RawFile) map[string]*Part {
 	resp := map[string]*Part{}
-	for k, part := range rawFile.Parts {
-		if subFile, ok := (*subFiles)[part.ID]; ok {
-			subResp := ReplaceSubFiles(subFile, subFiles)
-			for k2, part2 := range subResp {
-				if part2.Color == 16 {
-					// replace with parent color
-					part2.Color = part.Color
-					k2 = part2.ID + "-" + strconv.FormatInt(int64(part.Color), 10)
-				}
-
-				if _, ok2 := resp[k2]; !ok2 {
-					resp[k2] = part2
-				} else {
-					resp[k2].Count += part2.Count
-				}
+	for _, part := range rawFile.Parts {
+		subFile, isSub := (*subFiles)[part.ID]
+		if !isSub || subFile.Flex != nil {
+			id := part.ID
+			var flex *FlexInfo
+			if isSub {
+				// flexible part is one part, not segments
+				id, flex = subFile.Flex.Part, subFile.Flex
 			}
-			delete(rawFile.Parts, k) // remove self
-		} else {
-			if _, ok2 := resp[k]; !ok2 {
-				resp[k] = part
-			} else {
-				resp[k].Count += part.Count
+			one := addPartCount(resp, id, part.Color, part.Count)
+			one.addOrigIDs(part.OrigIDs...)
+			one.Flex = flex
+			continue
+		}
+
+		for _, part2 := range ReplaceSubFiles(subFile, subFiles) {
+			color := part2.Color
+			if color == 16 {
+				// replace with parent color
+				color = part.Color
 			}
+			one := addPartCount(resp, part2.ID, color, part2.Count*part.Count)
+			one.addOrigIDs(part2.OrigIDs...)
+			one.Flex = part2.Flex
 		}
 	}
 	return resp
@@ -0,0 +1,317 @@
+package ldraw
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseLdrFileError(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "bad.ldr")
+	if err := os.WriteFile(fileName, []byte("1 4 0 0 0 1 0 0 0 1 0 0 0 1 3001.dat\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := ParseLdrFile(fileName, NewRawFile())
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("want ParseError, got %v", err)
+	}
+	if pe.Line != 1 || !errors.Is(err, ErrBadLine) {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestParseDatBoundingBoxNotFound(t *testing.T) {
+	root := t.TempDir() + "/"
+	if err := os.MkdirAll(root+PartsLocation, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	fileName := root + PartsLocation + "broken.dat"
+	content := "0 broken\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 missing.dat\n"
+	if err := os.WriteFile(fileName, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := ParseDatBoundingBox(fileName, InitMatrix, root)
+	var pe *ParseError
+	if !errors.As(err, &pe) || pe.Line != 2 {
+		t.Fatalf("want ParseError at line 2, got %v", err)
+	}
+	if !errors.Is(err, ErrSubFileNotFound) {
+		t.Errorf("want ErrSubFileNotFound, got %v", err)
+	}
+	if rootParser(root) != rootParser(root) {
+		t.Error("want one parser per root")
+	}
+}
+
+func TestParseTransMatrix(t *testing.T) {
+	if _, err := ParseTransMatrix([]string{"1", "2"}); !errors.Is(err, ErrBadMatrix) {
+		t.Errorf("want ErrBadMatrix, got %v", err)
+	}
+	if _, err := ParseTransMatrix([]string{"0", "0", "0", "1", "0", "0", "0", "x", "0", "0", "0", "1"}); !errors.Is(err, ErrBadMatrix) {
+		t.Errorf("want ErrBadMatrix, got %v", err)
+	}
+}
+
+func TestParseDatFS(t *testing.T) {
+	lib := fstest.MapFS{
+		"parts/box.dat":      {Data: []byte("0 box\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 s/boxs01.dat\n")},
+		"parts/s/boxs01.dat": {Data: []byte("0 ~box side\n2 24 -10 0 -10 10 20 10\n")},
+	}
+
+	bb, err := ParseDatFS(lib, "parts/box.dat", InitMatrix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bb.CalcSize(); got != [3]float64{20, 20, 20} {
+		t.Errorf("wrong size: %v", got)
+	}
+}
+
+func TestParseLdrReader(t *testing.T) {
+	content := "0 FILE Main.ldr\n1 4 0 0 0 1 0 0 0 1 0 0 0 1 mybrick.dat\n1 4 0 -24 0 1 0 0 0 1 0 0 0 1 MyBrick.dat\n"
+	mainFile := NewRawFile()
+	if err := ParseLdrReader(strings.NewReader(content), "main.ldr", mainFile); err != nil {
+		t.Fatal(err)
+	}
+	if mainFile.Name != "main.ldr" {
+		t.Errorf("wrong name: %q", mainFile.Name)
+	}
+	if p := mainFile.Parts["mybrick.dat-4"]; p == nil || p.Count != 2 {
+		t.Errorf("wrong parts: %v", mainFile.Parts)
+	}
+}
+
+func TestParseLines(t *testing.T) {
+	content := "\ufeff0 Title\r\n0 // comment\r\n\r\n1 0x2FF0000 1 2 3 1 0 0 0 1 0 0 0 1 s\\my part.dat\r\n" +
+		"2 24 0 0 0 1 1 1\n3 16 0 0 0 1 0 0 0 1 0\n4 16 0 0 0 1 0 0 1 1 0 0 1 0\n5 24 0 0 0 1 0 0 0 1 0 0 0 1\n"
+	lines, err := ParseLines(strings.NewReader(content), "test.ldr")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantTypes := []int{0, 0, 1, 2, 3, 4, 5}
+	if len(lines) != len(wantTypes) {
+		t.Fatalf("want %d lines, got %d", len(wantTypes), len(lines))
+	}
+	for i, l := range lines {
+		if l.LineType() != wantTypes[i] {
+			t.Errorf("line %d: want type %d, got %d", i, wantTypes[i], l.LineType())
+		}
+	}
+
+	if m, ok := lines[0].(*Meta); !ok || m.Text != "Title" {
+		t.Errorf("wrong title line: %#v", lines[0])
+	}
+	if c, ok := lines[1].(*Comment); !ok || c.Text != "comment" {
+		t.Errorf("wrong comment line: %#v", lines[1])
+	}
+	ref := lines[2].(*SubfileRef)
+	if ref.Num != 4 || ref.Color != 0x2FF0000 || ref.Name != `s\my part.dat` || ref.Pos != (TransVector{1, 2, 3}) {
+		t.Errorf("wrong sub file line: %#v", ref)
+	}
+
+	if _, err := ParseLines(strings.NewReader("3 16 0 0 0 1 0 0\n"), "bad.dat"); !errors.Is(err, ErrBadLine) {
+		t.Errorf("want ErrBadLine, got %v", err)
+	}
+}
+
+func TestParseLinesSkipped(t *testing.T) {
+	content := "0 // comment first\n7 16 unknown type\n1 16 0 0 0 1 0 0\n2 24 0 0 0 1 1 1 0.5\n1 4 0 0 0 1 0 0 0 1 0 0 0 1 3001.dat\n"
+
+	// skipped like ldraw viewers do, kept as raw lines
+	lines, err := ParseLines(strings.NewReader(content), "model.ldr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 5 || lines[3].LineNum() != 4 || lines[3].(*Line).Points[1] != (TransVector{1, 1, 1}) {
+		t.Errorf("wrong lines: %v", lines)
+	}
+	if raw, ok := lines[1].(*RawLine); !ok || raw.Num != 2 || raw.Raw != "7 16 unknown type" || !errors.Is(raw.Err, ErrBadLine) {
+		t.Errorf("wrong raw line: %#v", lines[1])
+	}
+
+	mainFile := NewRawFile()
+	if err := ParseLdrReader(strings.NewReader(content), "model.ldr", mainFile); err != nil {
+		t.Fatal(err)
+	}
+	if p := mainFile.Parts["3001-4"]; p == nil || p.Count != 1 {
+		t.Errorf("wrong parts: %v", mainFile.Parts)
+	}
+
+	// recorded in tolerant mode
+	mainFile = NewRawFile()
+	mainFile.Report = &Report{}
+	if err := ParseLdrReader(strings.NewReader(content), "model.ldr", mainFile); err != nil {
+		t.Fatal(err)
+	}
+	if problems := mainFile.Report.Problems(); len(problems) != 2 || problems[0].Kind != ProblemBroken {
+		t.Errorf("wrong problems: %v", problems)
+	}
+}
+
+func TestParseLdrReaderMPD(t *testing.T) {
+	// LDCad/Studio style, no `0 NOFILE`
+	content := "0 FILE Main.ldr\n0 Main\n1 4 0 0 0 1 0 0 0 1 0 0 0 1 Sub.ldr\n" +
+		"0 FILE sub.ldr\n0 Sub\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 mybrick.dat\n" +
+		"0 !DATA texture.png\n0 !: aGVs\n0 !: bG8=\n" +
+		"0 FILE other.ldr\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 mybrick.dat\n0 NOFILE\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 mybrick.dat\n"
+	mainFile := NewRawFile()
+	if err := ParseLdrReader(strings.NewReader(content), "main.mpd", mainFile); err != nil {
+		t.Fatal(err)
+	}
+
+	if mainFile.Name != "main.ldr" || len(mainFile.Parts) != 1 {
+		t.Errorf("wrong main file: %q %v", mainFile.Name, mainFile.Parts)
+	}
+	if got := strings.Join(mainFile.SubFileOrder, ","); got != "sub.ldr,texture.png,other.ldr" {
+		t.Errorf("wrong sub files: %s", got)
+	}
+	if p := mainFile.SubFiles["other.ldr"].Parts["mybrick.dat-16"]; p == nil || p.Count != 1 {
+		t.Errorf("lines after NOFILE should be ignored: %v", mainFile.SubFiles["other.ldr"].Parts)
+	}
+	if data := mainFile.DataFiles["texture.png"]; data == nil || string(data.Content) != "hello" {
+		t.Errorf("wrong data file: %v", data)
+	}
+}
+
+func TestParseLdrReaderMPDLeadingComment(t *testing.T) {
+	content := "\n0 // exported by some tool\n\n0 FILE Main.ldr\n0 Main\n0 Name: main.ldr\n1 4 0 0 0 1 0 0 0 1 0 0 0 1 sub.ldr\n0 NOFILE\n" +
+		"0 FILE sub.ldr\n0 Sub\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 mybrick.dat\n0 NOFILE\n"
+	mainFile := NewRawFile()
+	if err := ParseLdrReader(strings.NewReader(content), "main.mpd", mainFile); err != nil {
+		t.Fatal(err)
+	}
+
+	if mainFile.Name != "main.ldr" || mainFile.Header.Title != "Main" {
+		t.Errorf("wrong main file: %q %+v", mainFile.Name, mainFile.Header)
+	}
+	if got := strings.Join(mainFile.SubFileOrder, ","); got != "sub.ldr" {
+		t.Errorf("wrong sub files: %s", got)
+	}
+	if p := mainFile.Parts["sub.ldr-4"]; p == nil || p.Count != 1 {
+		t.Errorf("wrong parts: %v", mainFile.Parts)
+	}
+
+	// sub files of ldr file with model lines stay sub files
+	content = "0 Model\n1 4 0 0 0 1 0 0 0 1 0 0 0 1 sub.ldr\n0 FILE sub.ldr\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 mybrick.dat\n"
+	mainFile = NewRawFile()
+	if err := ParseLdrReader(strings.NewReader(content), "model.ldr", mainFile); err != nil {
+		t.Fatal(err)
+	}
+	if mainFile.Name != "model" || mainFile.SubFiles["sub.ldr"] == nil {
+		t.Errorf("wrong main file: %q %v", mainFile.Name, mainFile.SubFileOrder)
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	content := "0 Brick  2 x  4\n0 Name: 3001.dat\n0 Author: James Jessiman\n0 !LDRAW_ORG Part UPDATE 2004-03\n" +
+		"0 !LICENSE Licensed under CC BY 2.0 and CC BY 4.0 : see CAreadme.txt\n\n0 BFC CERTIFY CCW\n\n" +
+		"0 !KEYWORDS brick, 2x4\n0 !KEYWORDS classic\n0 !HISTORY 2002-05-07 [unknown] BFC Certification\n" +
+		"1 16 0 0 0 1 0 0 0 1 0 0 0 1 s/3001s01.dat\n0 !CATEGORY Ignored\n"
+	lines, err := ParseLines(strings.NewReader(content), "3001.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := ParseHeader(lines)
+	if h.Title != "Brick  2 x  4" || h.Name != "3001.dat" || h.Author != "James Jessiman" ||
+		h.Org != "Part" || h.Update != "UPDATE 2004-03" || h.BFC != "CERTIFY CCW" || h.Category != "Brick" {
+		t.Errorf("wrong header: %+v", h)
+	}
+	if len(h.Keywords) != 3 || len(h.History) != 1 || !strings.HasPrefix(h.License, "Licensed") {
+		t.Errorf("wrong header lists: %+v", h)
+	}
+
+	// title after name
+	lines, _ = ParseLines(strings.NewReader("0 Name: car.ldr\n0 Author: someone\n0 Red Car\n0 ROTATION CENTER 0 0 0 1 \"Custom\"\n"), "car.ldr")
+	if h := ParseHeader(lines); h.Title != "Red Car" || h.Name != "car.ldr" {
+		t.Errorf("wrong header: %+v", h)
+	}
+}
+
+func TestParseLdrReaderFlex(t *testing.T) {
+	content := "0 FILE main.ldr\n1 4 0 0 0 1 0 0 0 1 0 0 0 1 hose.ldr\n1 4 0 0 0 1 0 0 0 1 0 0 0 1 mybrick.dat\n" +
+		"0 FILE hose.ldr\n0 !LDCAD CONTENT [type=path] [addFallBack=default]\n" +
+		"0 !LDCAD PATH_POINT [type=bezier] [posOri=0 0 0 1 0 0 0 1 0 0 0 1]\n" +
+		"0 !LDCAD GENERATED [generator=\"LDCad 1.6 Beta 2 (Win64)\"]\n" +
+		"1 16 0 0 0 1 0 0 0 1 0 0 0 1 cap.dat\n" +
+		"1 16 0 0 0 1 0 0 0 0 -1 0 1 0 seg.dat\n1 16 10 0 0 1 0 0 0 0 -1 0 1 0 seg.dat\n1 16 20 0 0 1 0 0 0 0 -1 0 1 0 seg.dat\n"
+	mainFile := NewRawFile()
+	if err := ParseLdrReader(strings.NewReader(content), "main.ldr", mainFile); err != nil {
+		t.Fatal(err)
+	}
+
+	flex := mainFile.SubFiles["hose.ldr"].Flex
+	if flex == nil || flex.Type != "path" || flex.Generator != "LDCad 1.6 Beta 2 (Win64)" ||
+		flex.Segment != "seg.dat" || flex.Segments != 3 || flex.Length != 30 || flex.Axis != (TransVector{1, 0, 0}) {
+		t.Fatalf("wrong flex: %+v", flex)
+	}
+
+	allParts := ReplaceSubFiles(mainFile, &mainFile.SubFiles)
+	if p := allParts["hose-4"]; len(allParts) != 2 || p == nil || p.ID != "hose" || p.Flex != flex {
+		t.Errorf("flex should be one part: %v", allParts)
+	}
+	if steps := StepParts(mainFile, &mainFile.SubFiles); len(steps) != 1 || steps[0]["hose-4"] == nil || steps[0]["hose-4"].Flex != flex {
+		t.Errorf("flex should be one part: %v", steps)
+	}
+}
+
+func TestParseLdrReaderMetaBlocks(t *testing.T) {
+	content := "0 FILE main.ldr\n" +
+		"1 4 0 0 0 1 0 0 0 1 0 0 0 1 sub.ldr\n1 4 0 0 40 1 0 0 0 1 0 0 0 1 sub.ldr\n" +
+		"0 !LPUB PLI BEGIN IGN\n1 1 0 0 0 1 0 0 0 1 0 0 0 1 mybrick.dat\n0 !LPUB PLI END\n" +
+		"0 LPUB PLI BEGIN SUB mysub.dat\n1 2 0 0 0 1 0 0 0 1 0 0 0 1 mybrick.dat\n1 2 0 8 0 1 0 0 0 1 0 0 0 1 mybrick.dat\n0 LPUB PLI END\n" +
+		"0 BUFEXCHG A STORE\n1 14 0 0 0 1 0 0 0 1 0 0 0 1 mybrick.dat\n0 BUFEXCHG A RETRIEVE\n" +
+		"0 FILE sub.ldr\n0 GROUP 2 wing\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 mybrick.dat\n1 16 0 0 20 1 0 0 0 1 0 0 0 1 mybrick.dat\n" +
+		"0 MLCAD BTG tail fin\n1 15 0 0 40 1 0 0 0 1 0 0 0 1 mybrick.dat\n1 16 0 0 60 1 0 0 0 1 0 0 0 1 mybrick.dat\n"
+	mainFile := NewRawFile()
+	if err := ParseLdrReader(strings.NewReader(content), "main.mpd", mainFile); err != nil {
+		t.Fatal(err)
+	}
+
+	got := ReplaceSubFiles(mainFile, &mainFile.SubFiles)
+	want := map[string]int{"mybrick.dat-4": 6, "mybrick.dat-15": 2, "mysub.dat-2": 1}
+	if len(got) != len(want) {
+		t.Errorf("wrong parts: %v", got)
+	}
+	for k, count := range want {
+		if p := got[k]; p == nil || p.Count != count {
+			t.Errorf("part %s: want %d, got %v", k, count, p)
+		}
+	}
+
+	// input is left as is, steps sum up to same totals
+	again := ReplaceSubFiles(mainFile, &mainFile.SubFiles)
+	steps := map[string]int{}
+	for _, step := range StepParts(mainFile, &mainFile.SubFiles) {
+		for k, p := range step {
+			steps[k] += p.Count
+		}
+	}
+	for k, count := range want {
+		if p := again[k]; p == nil || p.Count != count || steps[k] != count {
+			t.Errorf("part %s: want %d, got %v and %d of steps", k, count, p, steps[k])
+		}
+	}
+
+	sub := mainFile.SubFiles["sub.ldr"].Steps[0].Refs
+	if sub[0].Group != "wing" || sub[1].Group != "wing" || sub[2].Group != "tail fin" || sub[3].Group != "" {
+		t.Errorf("wrong groups: %q %q %q %q", sub[0].Group, sub[1].Group, sub[2].Group, sub[3].Group)
+	}
+
+	// substitute of PLI block never ended
+	mainFile = NewRawFile()
+	content = "0 Model\n0 !LPUB PLI BEGIN SUB mysub.dat 1\n1 2 0 0 0 1 0 0 0 1 0 0 0 1 mybrick.dat\n"
+	if err := ParseLdrReader(strings.NewReader(content), "model.ldr", mainFile); err != nil {
+		t.Fatal(err)
+	}
+	if p := mainFile.Parts["mysub.dat-1"]; len(mainFile.Parts) != 1 || p == nil || p.Count != 1 {
+		t.Errorf("wrong parts: %v", mainFile.Parts)
+	}
+}
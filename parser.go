@@ -0,0 +1,243 @@
+package ldraw
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/gob"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+)
+
+//go:embed ldraw_aio.gob
+var ldrawAIOGob []byte
+
+var (
+	embeddedOnce sync.Once
+	embeddedInfo *LdrInfo
+)
+
+// EmbeddedInfo parts list of built in library, decoded once on first use.
+// It is shared, do not change it.
+func EmbeddedInfo() *LdrInfo {
+	embeddedOnce.Do(func() {
+		got := &LdrInfo{}
+		gob.NewDecoder(bytes.NewBuffer(ldrawAIOGob)).Decode(&got)
+		embeddedInfo = got
+	})
+	return embeddedInfo
+}
+
+// AllP p(sub) files of built in library, decoded on first use.
+//
+// Deprecated: use EmbeddedInfo().P.
+func AllP() map[string]struct{} {
+	return EmbeddedInfo().P
+}
+
+// AllParts bounding boxes of parts of built in library, decoded on first use.
+//
+// Deprecated: use EmbeddedInfo().Parts.
+func AllParts() map[string][2][3]float64 {
+	return EmbeddedInfo().Parts
+}
+
+// Parser parse ldraw files with parts list of one library, it owns cache of
+// parsed library files, so parsers of different libraries share nothing.
+// Safe for concurrent use.
+type Parser struct {
+	Info    *LdrInfo // parts list, EmbeddedInfo if nil
+	Library fs.FS    // ldraw library, like *Library, for dat files, can be nil
+	Workers int      // files read at once, runtime.NumCPU() if 0
+
+	// Exact bounding boxes of rotated sub files from their transformed
+	// vertices instead of their transformed boxes, slower. Set before use.
+	Exact bool
+
+	parsed sync.Map // library path -> *BoundingBox, only of files without problems
+	lines  sync.Map // library path -> []LdrLine, only in Exact mode and without problems
+
+	l     sync.Mutex
+	calls map[datKey]*datCall // library files being parsed
+
+	semOnce sync.Once
+	sem     chan struct{} // workers reading files
+
+	infoOnce sync.Once
+	libInfo  *LdrInfo // Info reading missing headers from Library
+}
+
+// NewParser parser of parts list info and ldraw library lib, both can be nil
+func NewParser(info *LdrInfo, lib fs.FS) *Parser {
+	return &Parser{Info: info, Library: lib}
+}
+
+// rootParsers parser of each ldraw root dir of file path functions, parsed
+// library files are shared between their calls, so changes to library on
+// disk are not seen
+var rootParsers sync.Map // ldraw root -> *Parser
+
+// rootParser parser of built in parts list and library of ldrawRoot, one
+// per root
+func rootParser(ldrawRoot string) *Parser {
+	if got, ok := rootParsers.Load(ldrawRoot); ok {
+		return got.(*Parser)
+	}
+	got, _ := rootParsers.LoadOrStore(ldrawRoot, NewParser(nil, NewLibraryDirs(ldrawRoot)))
+	return got.(*Parser)
+}
+
+func (p *Parser) info() *LdrInfo {
+	p.infoOnce.Do(func() {
+		p.libInfo = p.Info
+		if p.libInfo == nil {
+			p.libInfo = EmbeddedInfo()
+		}
+		if p.Library != nil {
+			// own copy, shared info is not changed
+			base := p.libInfo
+			p.libInfo = &LdrInfo{P: base.P, Parts: base.Parts, Headers: base.Headers, Aliases: base.Aliases, lib: p.Library}
+		}
+	})
+	return p.libInfo
+}
+
+// PartHeader header of library part file, like `3001.dat`. Parts missing in
+// headers of parts list are read from library.
+func (p *Parser) PartHeader(name string) (*Header, bool) {
+	return p.info().Header(name)
+}
+
+// ParseDatFS parse dat file in library into bounding box
+func (p *Parser) ParseDatFS(fileName string, matrix *TransMatrix) (*BoundingBox, error) {
+	return p.ParseDatContext(context.Background(), fileName, matrix, nil)
+}
+
+// ParseDatFSTolerant parse dat file like ParseDatFS, missing or broken sub
+// files and lines are left out of bounding box and recorded in report
+func (p *Parser) ParseDatFSTolerant(fileName string, matrix *TransMatrix, report *Report) (*BoundingBox, error) {
+	return p.ParseDatContext(context.Background(), fileName, matrix, report)
+}
+
+// ParseDatContext parse dat file in library into bounding box, sub files are
+// parsed in parallel and each once. Tolerant mode if report is set, see
+// ParseDatFSTolerant. Parsing stops with ctx error once ctx is done.
+func (p *Parser) ParseDatContext(ctx context.Context, fileName string, matrix *TransMatrix, report *Report) (*BoundingBox, error) {
+	if got, ok := p.parsed.Load(fileName); ok {
+		// transform to new bounding box
+		resp := NewBoundingBox()
+		if err := p.mergeDat(ctx, resp, fileName, got.(*BoundingBox), matrix, nil); err != nil {
+			return nil, err
+		}
+		return resp.TransEmpty(), nil
+	}
+	return p.parseDatFS(ctx, fileName, matrix, report, topCall(fileName))
+}
+
+// ParseDatReader parse dat content, sub files are searched in library
+func (p *Parser) ParseDatReader(r io.Reader, fileName string, matrix *TransMatrix) (*BoundingBox, error) {
+	return p.ParseDatReaderContext(context.Background(), r, fileName, matrix, nil)
+}
+
+// ParseDatReaderContext parse dat content like ParseDatContext
+func (p *Parser) ParseDatReaderContext(ctx context.Context, r io.Reader, fileName string, matrix *TransMatrix, report *Report) (*BoundingBox, error) {
+	lines, err := parseLines(r, fileName, report)
+	if err != nil {
+		return nil, err
+	}
+	return p.parseDatLines(ctx, lines, fileName, matrix, report, topCall(fileName))
+}
+
+// ParseLdrFile parse ldr/mpd file into mainFile
+func (p *Parser) ParseLdrFile(fileName string, mainFile *RawFile) error {
+	mainFile.info = p.info()
+	return ParseLdrFile(fileName, mainFile)
+}
+
+// ParseLdrFS parse ldr/mpd file in fs into mainFile
+func (p *Parser) ParseLdrFS(fsys fs.FS, fileName string, mainFile *RawFile) error {
+	mainFile.info = p.info()
+	return ParseLdrFS(fsys, fileName, mainFile)
+}
+
+// ParseLdrReader parse ldr/mpd content into mainFile, see ParseLdrReader
+func (p *Parser) ParseLdrReader(r io.Reader, fileName string, mainFile *RawFile) error {
+	mainFile.info = p.info()
+	return ParseLdrReader(r, fileName, mainFile)
+}
+
+// ParseLXFFile parse LDD .lxf or .lxfml file into mainFile
+func (p *Parser) ParseLXFFile(fileName string, mapping *LDDMapping, mainFile *RawFile) error {
+	mainFile.info = p.info()
+	return ParseLXFFile(fileName, mapping, mainFile)
+}
+
+// ParseLXFMLReader parse LDD lxfml content into mainFile
+func (p *Parser) ParseLXFMLReader(r io.Reader, fileName string, mapping *LDDMapping, mainFile *RawFile) error {
+	mainFile.info = p.info()
+	return ParseLXFMLReader(r, fileName, mapping, mainFile)
+}
+
+// ParseIOFile parse studio .io file into mainFile, sub files of custom parts
+// are searched in custom parts first and then in library
+func (p *Parser) ParseIOFile(fileName string, mainFile *RawFile) error {
+	mainFile.info = p.info()
+	return ParseIOFile(fileName, mainFile, p.Library)
+}
+
+// ParseIOReader parse studio .io content into mainFile, see ParseIOFile
+func (p *Parser) ParseIOReader(r io.ReaderAt, size int64, fileName string, mainFile *RawFile) error {
+	mainFile.info = p.info()
+	return ParseIOReader(r, size, fileName, mainFile, p.Library)
+}
+
+// PackParts NewPackPartsReport with parts list of parser
+func (p *Parser) PackParts(partMap map[string]*Part, report *Report, customParts ...map[string][2][3]float64) *LdrBinPack {
+	return newPackParts(p.info(), partMap, report, customParts...)
+}
+
+// StepPackParts NewStepPackPartsReport with parts list of parser
+func (p *Parser) StepPackParts(steps []map[string]*Part, report *Report, customParts ...map[string][2][3]float64) LdrStepPack {
+	resp := LdrStepPack{}
+	for _, step := range steps {
+		if parts := p.PackParts(step, report, customParts...); parts.Len() > 0 {
+			resp = append(resp, parts)
+		}
+	}
+	return resp
+}
+
+// partInfo parts list file was parsed with
+func (rf *RawFile) partInfo() *LdrInfo {
+	if rf.info != nil {
+		return rf.info
+	}
+	return EmbeddedInfo()
+}
+
+// refPartID part id of sub file reference, false for ldraw p(sub) files.
+// Moved and alias parts are resolved to current part, orig is the referenced
+// id then, empty for others.
+func (info *LdrInfo) refPartID(ref *SubfileRef) (id, orig string, ok bool) {
+	//cast all to lower
+	name := strings.ToLower(ref.Name)
+
+	// in ldraw p(sub) dir do not parse
+	if _, ok := info.P[name]; ok {
+		return "", "", false
+	}
+
+	// in ldraw parts list
+	if _, ok := info.Parts[name]; ok {
+		if target := info.ResolveAlias(name); target != name {
+			if _, ok := info.Parts[target]; ok {
+				return target[:len(target)-4], name[:len(name)-4], true
+			}
+		}
+		return name[:len(name)-4], "", true
+	}
+	// inline sub file or custom parts
+	return name, "", true
+}
@@ -0,0 +1,405 @@
+package ldraw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestParserOwnCache(t *testing.T) {
+	t.Parallel()
+	libs := []fstest.MapFS{
+		{
+			"parts/box.dat":      {Data: []byte("0 box\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 s/boxs01.dat\n")},
+			"parts/s/boxs01.dat": {Data: []byte("0 ~box side\n2 24 -10 0 -10 10 20 10\n")},
+		},
+		{
+			"parts/box.dat":      {Data: []byte("0 box\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 s/boxs01.dat\n")},
+			"parts/s/boxs01.dat": {Data: []byte("0 ~box side, newer library\n2 24 -20 0 -20 20 40 20\n")},
+		},
+	}
+	want := [][3]float64{{20, 20, 20}, {40, 40, 40}}
+
+	// same paths in both libraries, no parser sees sizes of other library
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			parser := NewParser(&LdrInfo{}, libs[i%2])
+			for j := 0; j < 2; j++ {
+				bb, err := parser.ParseDatFS("parts/box.dat", InitMatrix)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if got := bb.CalcSize(); got != want[i%2] {
+					t.Errorf("library %d: want %v, got %v", i%2, want[i%2], got)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestParserInfo(t *testing.T) {
+	t.Parallel()
+	parser := NewParser(&LdrInfo{P: map[string]struct{}{"stud.dat": {}}, Parts: map[string][2][3]float64{"3001.dat": {{-40, -24, -20}, {40, 0, 20}}}}, nil)
+
+	mainFile := NewRawFile()
+	content := "0 model\n1 4 0 0 0 1 0 0 0 1 0 0 0 1 3001.dat\n1 4 0 0 0 1 0 0 0 1 0 0 0 1 stud.dat\n"
+	if err := parser.ParseLdrReader(strings.NewReader(content), "model.ldr", mainFile); err != nil {
+		t.Fatal(err)
+	}
+	if len(mainFile.Parts) != 1 || mainFile.Parts["3001-4"] == nil {
+		t.Fatalf("wrong parts: %v", mainFile.Parts)
+	}
+
+	parts := parser.PackParts(mainFile.Parts, nil)
+	if parts.Len() != 1 || (*parts)[0].W != 80 || (*parts)[0].Name != "3001.dat" {
+		t.Errorf("wrong pack: %+v", (*parts)[0])
+	}
+}
+
+// countFS fs counting opens of each file
+type countFS struct {
+	fs.FS
+	l      sync.Mutex
+	counts map[string]int
+}
+
+func (cfs *countFS) Open(name string) (fs.File, error) {
+	cfs.l.Lock()
+	cfs.counts[name]++
+	cfs.l.Unlock()
+	return cfs.FS.Open(name)
+}
+
+func TestParserParseOnce(t *testing.T) {
+	t.Parallel()
+	lib := fstest.MapFS{"p/stud.dat": {Data: []byte("0 stud\n2 24 -6 0 -6 6 -4 6\n")}}
+	for i := 0; i < 20; i++ {
+		content := "0 part\n"
+		for j := 0; j < 10; j++ {
+			content += fmt.Sprintf("1 16 %d 0 0 1 0 0 0 1 0 0 0 1 stud.dat\n", j*20)
+		}
+		lib[fmt.Sprintf("parts/%d.dat", i)] = &fstest.MapFile{Data: []byte(content)}
+	}
+	cfs := &countFS{FS: lib, counts: map[string]int{}}
+	parser := NewParser(&LdrInfo{}, NewLibrary(cfs))
+	parser.Workers = 4
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			bb, err := parser.ParseDatFS(fmt.Sprintf("parts/%d.dat", i), InitMatrix)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if got := bb.CalcSize(); got != [3]float64{192, 4, 12} {
+				t.Errorf("wrong size: %v", got)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := cfs.counts["p/stud.dat"]; n != 1 {
+		t.Errorf("want stud parsed once, got %d", n)
+	}
+}
+
+func TestParserRecursive(t *testing.T) {
+	t.Parallel()
+	lib := fstest.MapFS{
+		"parts/a.dat":   {Data: []byte("0 a\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 s/b.dat\n")},
+		"parts/s/b.dat": {Data: []byte("0 b\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 a.dat\n")},
+	}
+	if _, err := NewParser(&LdrInfo{}, lib).ParseDatFS("parts/a.dat", InitMatrix); !errors.Is(err, ErrRecursive) {
+		t.Errorf("want ErrRecursive, got %v", err)
+	}
+}
+
+// slowFS fs taking a while to open files, so files are parsed at same time
+type slowFS struct {
+	fs.FS
+}
+
+func (sfs slowFS) Open(name string) (fs.File, error) {
+	time.Sleep(20 * time.Millisecond)
+	return sfs.FS.Open(name)
+}
+
+func TestParserRecursiveConcurrent(t *testing.T) {
+	t.Parallel()
+	// a and b are parsed at once from car, then wait for each other
+	lib := slowFS{fstest.MapFS{
+		"parts/car.dat": {Data: []byte("0 car\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 a.dat\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 b.dat\n")},
+		"parts/a.dat":   {Data: []byte("0 a\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 b.dat\n2 24 0 0 0 10 10 10\n")},
+		"parts/b.dat":   {Data: []byte("0 b\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 a.dat\n2 24 0 0 0 10 10 10\n")},
+	}}
+
+	for _, report := range []*Report{nil, {}} {
+		done := make(chan error, 1)
+		go func() {
+			parser := NewParser(&LdrInfo{}, lib)
+			parser.Workers = 2
+			_, err := parser.ParseDatContext(context.Background(), "parts/car.dat", InitMatrix, report)
+			done <- err
+		}()
+
+		select {
+		case err := <-done:
+			if report == nil && !errors.Is(err, ErrRecursive) {
+				t.Errorf("want ErrRecursive, got %v", err)
+			}
+			if report != nil && (err != nil || report.Len() == 0) {
+				t.Errorf("want recursion in report, got %v %v", err, report.Problems())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("deadlock of files referencing each other")
+		}
+	}
+}
+
+func TestParserCancel(t *testing.T) {
+	t.Parallel()
+	lib := fstest.MapFS{
+		"parts/box.dat":      {Data: []byte("0 box\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 s/boxs01.dat\n")},
+		"parts/s/boxs01.dat": {Data: []byte("0 ~box side\n2 24 -10 0 -10 10 20 10\n")},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// canceled even in tolerant mode
+	report := &Report{}
+	if _, err := NewParser(&LdrInfo{}, lib).ParseDatContext(ctx, "parts/box.dat", InitMatrix, report); !errors.Is(err, context.Canceled) {
+		t.Errorf("want context.Canceled, got %v", err)
+	}
+	if report.Len() != 0 {
+		t.Errorf("want no problems, got %v", report.Problems())
+	}
+}
+
+func TestParserRotated(t *testing.T) {
+	t.Parallel()
+	lib := fstest.MapFS{
+		"parts/brick.dat":  {Data: []byte("0 brick\n2 24 0 0 0 20 10 5\n")},
+		"parts/turned.dat": {Data: []byte("0 brick turned 90\n1 16 0 0 0 0 0 1 0 1 0 -1 0 0 brick.dat\n")},
+		"p/diamond.dat":    {Data: []byte("0 diamond\n2 24 10 0 0 0 0 10\n2 24 -10 0 0 0 0 -10\n")},
+		"parts/turn45.dat": {Data: []byte("0 diamond turned 45\n1 16 0 0 0 0.7071068 0 0.7071068 0 1 0 -0.7071068 0 0.7071068 diamond.dat\n")},
+		"parts/back.dat":   {Data: []byte("0 diamond turned back\n1 16 0 0 0 0.7071068 0 -0.7071068 0 1 0 0.7071068 0 0.7071068 turn45.dat\n")},
+	}
+	near := func(got, want [3]float64) bool {
+		for i := range got {
+			if got[i] < want[i]-1e-3 || got[i] > want[i]+1e-3 {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, tc := range []struct {
+		exact bool
+		file  string
+		want  [3]float64
+	}{
+		{false, "parts/turned.dat", [3]float64{5, 10, 20}},
+		{true, "parts/turned.dat", [3]float64{5, 10, 20}},
+		// corners of box of diamond
+		{false, "parts/turn45.dat", [3]float64{28.284, 0, 28.284}},
+		{true, "parts/turn45.dat", [3]float64{14.142, 0, 14.142}},
+		// turned 45 and back, exact again
+		{true, "parts/back.dat", [3]float64{20, 0, 20}},
+	} {
+		parser := NewParser(&LdrInfo{}, lib)
+		parser.Exact = tc.exact
+		for i := 0; i < 2; i++ {
+			// second round from cache
+			bb, err := parser.ParseDatFS(tc.file, InitMatrix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := bb.CalcSize(); !near(got, tc.want) {
+				t.Errorf("%s exact %v: want %v, got %v", tc.file, tc.exact, tc.want, got)
+			}
+		}
+		// cached file placed rotated
+		bb, err := parser.ParseDatFS(tc.file, AxisAngleMatrix(0, 1, 0, math.Pi/2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := bb.CalcSize(), [3]float64{tc.want[2], tc.want[1], tc.want[0]}; !near(got, want) {
+			t.Errorf("%s exact %v turned: want %v, got %v", tc.file, tc.exact, want, got)
+		}
+	}
+}
+
+func TestParserRotatedRecursive(t *testing.T) {
+	t.Parallel()
+	// b placed turned 45 in a and the other way round
+	lib := fstest.MapFS{
+		"parts/car.dat": {Data: []byte("0 car\n1 16 0 0 0 0.7071068 0 0.7071068 0 1 0 -0.7071068 0 0.7071068 a.dat\n")},
+		"parts/a.dat":   {Data: []byte("0 a\n1 16 0 0 0 0.7071068 0 0.7071068 0 1 0 -0.7071068 0 0.7071068 b.dat\n2 24 10 0 0 -10 0 0\n")},
+		"parts/b.dat":   {Data: []byte("0 b\n1 16 0 0 0 0.7071068 0 -0.7071068 0 1 0 0.7071068 0 0.7071068 a.dat\n2 24 0 0 10 0 0 -10\n")},
+	}
+	parser := NewParser(&LdrInfo{}, lib)
+	parser.Exact = true
+
+	for i := 0; i < 2; i++ {
+		report := &Report{}
+		bb, err := parser.ParseDatFSTolerant("parts/car.dat", InitMatrix, report)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Len() == 0 || bb.CalcSize()[1] != 0 {
+			t.Errorf("wrong box %v or problems %v", bb.CalcSize(), report.Problems())
+		}
+	}
+}
+
+// benchLibrary library of parts built from shared primitives, like a small
+// ldraw library
+func benchLibrary(parts int) fstest.MapFS {
+	stud := "0 stud\n"
+	for i := 0; i < 16; i++ {
+		a, b := float64(i)*math.Pi/8, float64(i+1)*math.Pi/8
+		x1, z1, x2, z2 := 6*math.Cos(a), 6*math.Sin(a), 6*math.Cos(b), 6*math.Sin(b)
+		stud += fmt.Sprintf("4 16 %g 0 %g %g 0 %g %g -4 %g %g -4 %g\n", x1, z1, x2, z2, x2, z2, x1, z1)
+		stud += fmt.Sprintf("3 16 0 -4 0 %g -4 %g %g -4 %g\n", x1, z1, x2, z2)
+		stud += fmt.Sprintf("2 24 %g -4 %g %g -4 %g\n", x1, z1, x2, z2)
+	}
+	lib := fstest.MapFS{
+		"p/stud.dat": {Data: []byte(stud)},
+		"p/box.dat":  {Data: []byte("0 box\n4 16 -1 1 -1 1 1 -1 1 1 1 -1 1 1\n4 16 -1 -1 -1 1 -1 -1 1 -1 1 -1 -1 1\n4 16 -1 -1 -1 1 -1 -1 1 1 -1 -1 1 -1\n4 16 -1 -1 1 1 -1 1 1 1 1 -1 1 1\n")},
+	}
+	for i := 0; i < parts; i++ {
+		part := fmt.Sprintf("0 part %d\n1 16 0 12 0 %d 0 0 0 12 0 0 0 10 box.dat\n", i, 10*(i%4+1))
+		for j := 0; j < 8; j++ {
+			turn := AxisAngleMatrix(0, 1, 0, float64(j)*0.3)
+			part += fmt.Sprintf("1 16 %d 0 %d %s stud.dat\n", 20*(j%4), 20*(j/4), strings.SplitN(turn.String(), " ", 4)[3])
+		}
+		lib[fmt.Sprintf("parts/%d.dat", i)] = &fstest.MapFile{Data: []byte(part)}
+	}
+	return lib
+}
+
+func BenchmarkParserLibrary(b *testing.B) {
+	lib := benchLibrary(200)
+	for _, exact := range []bool{false, true} {
+		b.Run(fmt.Sprintf("exact=%v", exact), func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				parser := NewParser(&LdrInfo{}, lib)
+				parser.Exact = exact
+				for i := 0; i < 200; i++ {
+					if _, err := parser.ParseDatFS(fmt.Sprintf("parts/%d.dat", i), InitMatrix); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParserLibraryInfo(t *testing.T) {
+	t.Parallel()
+	lib := fstest.MapFS{
+		"p/stud.dat":          {Data: []byte("0 stud\n2 24 -6 0 -6 6 -4 6\n")},
+		"p/48/ring.dat":       {Data: []byte("0 ring\n2 24 -1 0 -1 1 0 1\n")},
+		"parts/3001.dat":      {Data: []byte("0 Brick  2 x  4\n0 Name: 3001.dat\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 s/3001s01.dat\n1 16 0 -24 0 1 0 0 0 1 0 0 0 1 stud.dat\n")},
+		"parts/s/3001s01.dat": {Data: []byte("0 ~Brick  2 x  4 box\n2 24 -40 0 -20 40 -24 20\n")},
+		"parts/3001old.dat":   {Data: []byte("0 ~Moved to 3001\n0 Name: 3001old.dat\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 3001.dat\n")},
+	}
+
+	info, err := NewParser(&LdrInfo{}, lib).LibraryInfo(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := info.P["48/ring.dat"]; !ok || len(info.P) != 2 {
+		t.Errorf("wrong p files: %v", info.P)
+	}
+	if got := info.Parts["3001.dat"]; len(info.Parts) != 2 || got != [2][3]float64{{-40, -28, -20}, {40, 0, 20}} {
+		t.Errorf("wrong parts: %v", info.Parts)
+	}
+	if h := info.Headers["3001.dat"]; h == nil || h.Title != "Brick  2 x  4" || len(info.Headers) != 2 {
+		t.Errorf("wrong headers: %v", info.Headers)
+	}
+	if len(info.Aliases) != 1 || info.Aliases["3001old.dat"] != "3001.dat" {
+		t.Errorf("wrong aliases: %v", info.Aliases)
+	}
+
+	// broken part fails, or is sized without missing sub file
+	lib["parts/broken.dat"] = &fstest.MapFile{Data: []byte("0 broken\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 missing.dat\n2 24 0 0 0 1 1 1\n")}
+	if _, err := NewParser(&LdrInfo{}, lib).LibraryInfo(context.Background(), nil); !errors.Is(err, ErrSubFileNotFound) {
+		t.Errorf("want ErrSubFileNotFound, got %v", err)
+	}
+	report := &Report{}
+	info, err = NewParser(&LdrInfo{}, lib).LibraryInfo(context.Background(), report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := info.Parts["broken.dat"]; !ok || report.Len() != 1 {
+		t.Errorf("wrong parts %v or problems %v", info.Parts, report.Problems())
+	}
+}
+
+// BenchmarkParserLibraryInfo parts list of ldraw library in LDRAWDIR, like
+// generate does
+func BenchmarkParserLibraryInfo(b *testing.B) {
+	dir := os.Getenv(LDrawDirEnv)
+	if dir == "" {
+		b.Skipf("%s not set", LDrawDirEnv)
+	}
+	lib, err := NewLibraryPaths(dir)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer lib.Close()
+
+	for _, exact := range []bool{false, true} {
+		b.Run(fmt.Sprintf("exact=%v", exact), func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				parser := NewParser(&LdrInfo{}, lib)
+				parser.Exact = exact
+				if _, err := parser.LibraryInfo(context.Background(), &Report{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestParserPartHeader(t *testing.T) {
+	t.Parallel()
+	lib := fstest.MapFS{"parts/3001.dat": {Data: []byte("0 Brick  2 x  4\n0 Name: 3001.dat\n0 !LDRAW_ORG Part UPDATE 2004-03\n")}}
+	info := &LdrInfo{Headers: map[string]*Header{"3003.dat": {Title: "Brick  2 x  2"}}}
+
+	parser := NewParser(info, lib)
+	if h, ok := parser.PartHeader("3003.dat"); !ok || h.Title != "Brick  2 x  2" {
+		t.Errorf("want header of parts list, got %+v", h)
+	}
+	if h, ok := parser.PartHeader("3001.DAT"); !ok || h.Title != "Brick  2 x  4" || h.Category != "Brick" {
+		t.Errorf("want header of library, got %+v", h)
+	}
+	if _, ok := parser.PartHeader("3002.dat"); ok {
+		t.Error("want no header of missing part")
+	}
+	if _, ok := NewParser(info, nil).PartHeader("3001.dat"); ok {
+		t.Error("want no header without library")
+	}
+	if info.lib != nil {
+		t.Error("parts list of parser changed")
+	}
+}
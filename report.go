@@ -0,0 +1,95 @@
+package ldraw
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Problem kinds of Report
+const (
+	ProblemMissing = "missing" // part or sub file not found
+	ProblemBroken  = "broken"  // part or line can not be parsed
+)
+
+// Problem one missing or broken part
+type Problem struct {
+	Kind string // ProblemMissing or ProblemBroken
+	Part string // part or file name
+	Err  error  // cause, *ParseError if line related
+}
+
+func (p *Problem) String() string {
+	return fmt.Sprintf("%s %s: %v", p.Kind, p.Part, p.Err)
+}
+
+// Report problems of tolerant mode, parsing goes on after missing or
+// broken parts, which are recorded here. Safe for concurrent use.
+type Report struct {
+	l        sync.Mutex
+	problems []*Problem
+	tainted  bool    // result depends on file with problems
+	parent   *Report // problems are also recorded in parent
+}
+
+// Add record problem of part
+func (r *Report) Add(kind, part string, err error) {
+	problem := &Problem{Kind: kind, Part: part, Err: err}
+	for ; r != nil; r = r.parent {
+		r.l.Lock()
+		r.problems = append(r.problems, problem)
+		r.l.Unlock()
+	}
+}
+
+// Problems recorded problems in order
+func (r *Report) Problems() []*Problem {
+	r.l.Lock()
+	defer r.l.Unlock()
+	return append([]*Problem{}, r.problems...)
+}
+
+// Len count of problems
+func (r *Report) Len() int {
+	r.l.Lock()
+	defer r.l.Unlock()
+	return len(r.problems)
+}
+
+// child report of one file, its problems are recorded in r too. nil in
+// strict mode.
+func (r *Report) child() *Report {
+	if r == nil {
+		return nil
+	}
+	return &Report{parent: r}
+}
+
+// taint mark r and parents as using a file with problems, which are
+// recorded by report of that file already
+func (r *Report) taint() {
+	for ; r != nil; r = r.parent {
+		r.l.Lock()
+		r.tainted = true
+		r.l.Unlock()
+	}
+}
+
+// clean no problems recorded and no file with problems used, strict mode
+// is always clean as problems are errors there
+func (r *Report) clean() bool {
+	if r == nil {
+		return true
+	}
+	r.l.Lock()
+	defer r.l.Unlock()
+	return len(r.problems) == 0 && !r.tainted
+}
+
+// tolerate record err in report and go on, or return err if report is nil
+func (r *Report) tolerate(kind, part string, err error) error {
+	if r == nil || err == nil {
+		return err
+	}
+	r.Add(kind, part, err)
+	return nil
+}
@@ -0,0 +1,106 @@
+package ldraw
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseLdrReaderTolerant(t *testing.T) {
+	content := "0 Model\n1 4 0 0 0 1 0 0 0 1 0 0 0 1 mybrick.dat\n1 4 broken line\n" +
+		"0 !COLOUR Bad CODE x VALUE #FF0000 EDGE #000000\n1 4 0 -24 0 1 0 0 0 1 0 0 0 1 mybrick.dat\n"
+
+	// skipped in strict mode
+	mainFile := NewRawFile()
+	if err := ParseLdrReader(strings.NewReader(content), "model.ldr", mainFile); err != nil {
+		t.Fatal(err)
+	}
+	if p := mainFile.Parts["mybrick.dat-4"]; p == nil || p.Count != 2 || mainFile.Colors.Len() != 0 {
+		t.Errorf("wrong parts: %v", mainFile.Parts)
+	}
+
+	mainFile = NewRawFile()
+	mainFile.Report = &Report{}
+	if err := ParseLdrReader(strings.NewReader(content), "model.ldr", mainFile); err != nil {
+		t.Fatal(err)
+	}
+	if p := mainFile.Parts["mybrick.dat-4"]; p == nil || p.Count != 2 {
+		t.Errorf("wrong parts: %v", mainFile.Parts)
+	}
+
+	problems := mainFile.Report.Problems()
+	if len(problems) != 2 || problems[0].Kind != ProblemBroken {
+		t.Fatalf("wrong problems: %v", problems)
+	}
+	var pe *ParseError
+	if !errors.As(problems[0].Err, &pe) || pe.Line != 3 {
+		t.Errorf("wrong problem: %v", problems[0])
+	}
+}
+
+func TestParseDatFSTolerant(t *testing.T) {
+	lib := fstest.MapFS{
+		"parts/box.dat":      {Data: []byte("0 box\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 s/boxs01.dat\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 s/missing.dat\n")},
+		"parts/s/boxs01.dat": {Data: []byte("0 ~box side\n2 24 -10 0 -10 10 20 10\n")},
+	}
+
+	if _, err := ParseDatFS(lib, "parts/box.dat", InitMatrix); !errors.Is(err, ErrSubFileNotFound) {
+		t.Fatalf("want ErrSubFileNotFound, got %v", err)
+	}
+
+	report := &Report{}
+	bb, err := ParseDatFSTolerant(lib, "parts/box.dat", InitMatrix, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bb.CalcSize(); got != [3]float64{20, 20, 20} {
+		t.Errorf("wrong size: %v", got)
+	}
+	if problems := report.Problems(); len(problems) != 1 || problems[0].Kind != ProblemMissing || problems[0].Part != "s/missing.dat" {
+		t.Errorf("wrong problems: %v", problems)
+	}
+}
+
+func TestNewPackPartsReport(t *testing.T) {
+	partMap := map[string]*Part{"notapart-4": {ID: "notapart", Color: 4, Count: 2}}
+
+	if parts := NewPackParts(partMap); parts.Len() != 0 {
+		t.Errorf("want missing part left out, got %d", parts.Len())
+	}
+
+	report := &Report{}
+	parts := NewPackPartsReport(partMap, report)
+	if parts.Len() != 2 || !(*parts)[0].Placeholder || report.Len() != 1 {
+		t.Fatalf("want 2 placeholders and 1 problem, got %d %d", parts.Len(), report.Len())
+	}
+	if line := (*parts)[0].StandLine(); !strings.Contains(line, "placeholder of notapart.dat") || !strings.HasSuffix(line, " 10 0 0 0 12 0 0 0 10 box.dat\n") {
+		t.Errorf("wrong line: %q", line)
+	}
+}
+
+func TestParserTolerantNotCached(t *testing.T) {
+	parser := NewParser(nil, fstest.MapFS{
+		"parts/car.dat":      {Data: []byte("0 car\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 box.dat\n")},
+		"parts/truck.dat":    {Data: []byte("0 truck\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 box.dat\n")},
+		"parts/box.dat":      {Data: []byte("0 box\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 s/boxs01.dat\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 s/missing.dat\n")},
+		"parts/s/boxs01.dat": {Data: []byte("0 ~box side\n2 24 -10 0 -10 10 20 10\n")},
+	})
+
+	report := &Report{}
+	if _, err := parser.ParseDatFSTolerant("parts/car.dat", InitMatrix, report); err != nil || report.Len() != 1 {
+		t.Fatalf("want 1 problem, got %v %v", report.Problems(), err)
+	}
+
+	// box without its missing sub file is not shared
+	if _, err := parser.ParseDatFS("parts/truck.dat", InitMatrix); !errors.Is(err, ErrSubFileNotFound) {
+		t.Errorf("want ErrSubFileNotFound, got %v", err)
+	}
+	report = &Report{}
+	if _, err := parser.ParseDatFSTolerant("parts/truck.dat", InitMatrix, report); err != nil || report.Len() != 1 {
+		t.Errorf("want 1 problem, got %v %v", report.Problems(), err)
+	}
+	if _, ok := parser.parsed.Load("parts/s/boxs01.dat"); !ok {
+		t.Error("sub file without problems should be shared")
+	}
+}
@@ -0,0 +1,96 @@
+package ldraw
+
+import (
+	"strconv"
+)
+
+// Step one building step of file
+type Step struct {
+	Refs []*SubfileRef
+	End  *Meta // `0 STEP` or `0 ROTSTEP` ends this step, nil for last open step
+}
+
+// addStepRef add sub file reference to current step
+func (rf *RawFile) addStepRef(ref *SubfileRef) {
+	if len(rf.Steps) == 0 || rf.Steps[len(rf.Steps)-1].End != nil {
+		rf.Steps = append(rf.Steps, &Step{})
+	}
+	step := rf.Steps[len(rf.Steps)-1]
+	step.Refs = append(step.Refs, ref)
+}
+
+// endStep end current step, empty step is kept
+func (rf *RawFile) endStep(end *Meta) {
+	if len(rf.Steps) == 0 || rf.Steps[len(rf.Steps)-1].End != nil {
+		rf.Steps = append(rf.Steps, &Step{})
+	}
+	rf.Steps[len(rf.Steps)-1].End = end
+}
+
+// StepParts parts list of each building step, sub files are expanded in
+// building order: all steps of sub file come before the step placing it.
+func StepParts(rawFile *RawFile, subFiles *map[string]*RawFile) []map[string]*Part {
+	resp := []map[string]*Part{}
+	for _, step := range rawFile.Steps {
+		own := map[string]*Part{}
+		subRefs := map[string]*Part{}
+		subOrder := []string{}
+
+		for _, ref := range step.Refs {
+			id, orig, ok := rawFile.partInfo().refPartID(ref)
+			if !ok || ref.Ignored {
+				continue
+			}
+
+			k := id + "-" + strconv.Itoa(ref.Color)
+			sub, isSub := (*subFiles)[id]
+			if isSub && sub.Flex == nil {
+				if _, ok := subRefs[k]; !ok {
+					subOrder = append(subOrder, k)
+				}
+				addPartCount(subRefs, id, ref.Color, 1)
+				continue
+			}
+			var flex *FlexInfo
+			if isSub {
+				// flexible part is one part, not segments
+				id, flex = sub.Flex.Part, sub.Flex
+			}
+			one := addPartCount(own, id, ref.Color, 1)
+			one.addOrigIDs(orig)
+			one.Flex = flex
+		}
+
+		for _, k := range subOrder {
+			subRef := subRefs[k]
+			for _, subStep := range StepParts((*subFiles)[subRef.ID], subFiles) {
+				one := map[string]*Part{}
+				for _, part := range subStep {
+					color := part.Color
+					if color == 16 {
+						// replace with parent color
+						color = subRef.Color
+					}
+					got := addPartCount(one, part.ID, color, part.Count*subRef.Count)
+					got.addOrigIDs(part.OrigIDs...)
+					got.Flex = part.Flex
+				}
+				resp = append(resp, one)
+			}
+		}
+
+		resp = append(resp, own)
+	}
+	return resp
+}
+
+// addPartCount add count of part to parts map, the part is returned
+func addPartCount(parts map[string]*Part, id string, color, count int) *Part {
+	k := id + "-" + strconv.Itoa(color)
+	if fp, ok := parts[k]; ok {
+		fp.Count += count
+		return fp
+	}
+	parts[k] = &Part{ID: id, Color: color, Count: count}
+	return parts[k]
+}
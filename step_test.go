@@ -0,0 +1,42 @@
+package ldraw
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStepParts(t *testing.T) {
+	content := "0 FILE main.ldr\n" +
+		"1 4 0 0 0 1 0 0 0 1 0 0 0 1 mybrick.dat\n0 STEP\n" +
+		"1 1 0 0 0 1 0 0 0 1 0 0 0 1 wheel.ldr\n1 1 0 0 0 1 0 0 0 1 0 0 0 1 wheel.ldr\n1 4 0 0 0 1 0 0 0 1 0 0 0 1 mybrick.dat\n0 ROTSTEP 0 90 0 ABS\n" +
+		"0 FILE wheel.ldr\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 rim.dat\n0 STEP\n1 0 0 0 0 1 0 0 0 1 0 0 0 1 tyre.dat\n"
+	mainFile := NewRawFile()
+	if err := ParseLdrReader(strings.NewReader(content), "main.ldr", mainFile); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mainFile.Steps) != 2 || mainFile.Steps[1].End.Command != "ROTSTEP" {
+		t.Fatalf("wrong steps: %v", mainFile.Steps)
+	}
+
+	steps := StepParts(mainFile, &mainFile.SubFiles)
+	want := []map[string]int{
+		{"mybrick.dat-4": 1},
+		{"rim.dat-1": 2},
+		{"tyre.dat-0": 2},
+		{"mybrick.dat-4": 1},
+	}
+	if len(steps) != len(want) {
+		t.Fatalf("want %d steps, got %d", len(want), len(steps))
+	}
+	for i, step := range steps {
+		if len(step) != len(want[i]) {
+			t.Errorf("step %d: wrong parts %v", i, step)
+		}
+		for k, count := range want[i] {
+			if p := step[k]; p == nil || p.Count != count {
+				t.Errorf("step %d: want %s x%d, got %v", i, k, count, p)
+			}
+		}
+	}
+}
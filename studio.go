@@ -0,0 +1,191 @@
+package ldraw
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	// StudioModelName ldraw model inside studio .io file
+	StudioModelName = `model.ldr`
+	// StudioCustomPartsLocation custom parts library inside studio .io file
+	StudioCustomPartsLocation = `CustomParts/`
+	// StudioPassword zip password of encrypted studio .io file
+	StudioPassword = `soho0909`
+)
+
+// ErrBadPassword zip entry can not be decrypted
+var ErrBadPassword = errors.New("wrong zip password")
+
+// ParseIOFile parse BrickLink Studio .io file into mainFile, bounding boxes of
+// custom parts are put into mainFile.CustomParts, their sub files are searched
+// in custom parts first and then in ldraw library fs lib, which can be nil.
+// Broken custom parts fail the parse, or are put into mainFile.Report in
+// tolerant mode.
+func ParseIOFile(fileName string, mainFile *RawFile, lib fs.FS) error {
+	oneReader, errF := os.Open(fileName)
+	if errF != nil {
+		return &ParseError{File: fileName, Err: errF}
+	}
+	defer oneReader.Close()
+
+	info, errS := oneReader.Stat()
+	if errS != nil {
+		return &ParseError{File: fileName, Err: errS}
+	}
+
+	return ParseIOReader(oneReader, info.Size(), fileName, mainFile, lib)
+}
+
+// ParseIOReader parse studio .io content into mainFile, see ParseIOFile
+func ParseIOReader(r io.ReaderAt, size int64, fileName string, mainFile *RawFile, lib fs.FS) error {
+	files, err := readStudioZip(r, size)
+	if err != nil {
+		return &ParseError{File: fileName, Err: err}
+	}
+
+	if err := ParseLdrFS(files, StudioModelName, mainFile); err != nil {
+		return &ParseError{File: fileName, Err: err}
+	}
+
+	customParts, _ := fs.Sub(files, strings.TrimSuffix(StudioCustomPartsLocation, "/"))
+	// custom parts shadow library ones, parsed apart from other libraries
+	customParser := NewParser(mainFile.info, overlayFS{customParts, lib})
+	for name := range files {
+		if !strings.HasPrefix(name, StudioCustomPartsLocation+PartsLocation) || path.Ext(name) != ".dat" {
+			continue
+		}
+		partName := strings.TrimPrefix(name, StudioCustomPartsLocation+PartsLocation)
+		if strings.HasPrefix(partName, "s/") {
+			continue
+		}
+
+		bb, err := customParser.ParseDatContext(context.Background(), strings.TrimPrefix(name, StudioCustomPartsLocation), InitMatrix, mainFile.Report)
+		if err != nil {
+			// no size in tolerant mode, custom part is still counted
+			if err := mainFile.Report.tolerate(ProblemBroken, partName, err); err != nil {
+				return &ParseError{File: fileName, Err: err}
+			}
+			continue
+		}
+		mainFile.CustomParts[partName] = bb.ToGob()
+	}
+	return nil
+}
+
+// readStudioZip read all files of zip, encrypted ones are decrypted with StudioPassword.
+// Names in custom parts are cast to lower.
+func readStudioZip(r io.ReaderAt, size int64) (memFS, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	files := memFS{}
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+
+		data, err := readZipEntry(r, f, StudioPassword)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+
+		name := strings.ReplaceAll(f.Name, "\\", "/")
+		if strings.HasPrefix(name, StudioCustomPartsLocation) {
+			name = StudioCustomPartsLocation + strings.ToLower(strings.TrimPrefix(name, StudioCustomPartsLocation))
+		}
+		files[name] = data
+	}
+	return files, nil
+}
+
+// readZipEntry read zip entry, traditional PKWARE encrypted entry is decrypted with password
+func readZipEntry(r io.ReaderAt, f *zip.File, password string) ([]byte, error) {
+	if f.Flags&0x1 == 0 {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+
+	offset, err := f.DataOffset()
+	if err != nil {
+		return nil, err
+	}
+	raw := make([]byte, f.CompressedSize64)
+	if _, err := r.ReadAt(raw, offset); err != nil {
+		return nil, err
+	}
+	if len(raw) < 12 {
+		return nil, zip.ErrFormat
+	}
+
+	zc := newZipCrypto(password)
+	zc.decrypt(raw)
+	// last byte of 12 bytes encryption header is check byte
+	check := byte(f.CRC32 >> 24)
+	if f.Flags&0x8 != 0 {
+		check = byte(f.ModifiedTime >> 8)
+	}
+	if raw[11] != check {
+		return nil, ErrBadPassword
+	}
+	raw = raw[12:]
+
+	var data []byte
+	switch f.Method {
+	case zip.Store:
+		data = raw
+	case zip.Deflate:
+		if data, err = io.ReadAll(flate.NewReader(bytes.NewReader(raw))); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, zip.ErrAlgorithm
+	}
+
+	if crc32.ChecksumIEEE(data) != f.CRC32 {
+		return nil, zip.ErrChecksum
+	}
+	return data, nil
+}
+
+// zipCrypto traditional PKWARE zip encryption
+type zipCrypto [3]uint32
+
+func newZipCrypto(password string) *zipCrypto {
+	zc := &zipCrypto{0x12345678, 0x23456789, 0x34567890}
+	for i := 0; i < len(password); i++ {
+		zc.update(password[i])
+	}
+	return zc
+}
+
+func (zc *zipCrypto) update(b byte) {
+	zc[0] = crc32.IEEETable[byte(zc[0])^b] ^ (zc[0] >> 8)
+	zc[1] = (zc[1]+zc[0]&0xff)*134775813 + 1
+	zc[2] = crc32.IEEETable[byte(zc[2])^byte(zc[1]>>24)] ^ (zc[2] >> 8)
+}
+
+// decrypt decrypt data in place
+func (zc *zipCrypto) decrypt(data []byte) {
+	for i, c := range data {
+		t := zc[2] | 2
+		data[i] = c ^ byte((t*(t^1))>>8)
+		zc.update(data[i])
+	}
+}
@@ -0,0 +1,125 @@
+package ldraw
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// newStudioZip zip of files like studio .io file, not encrypted
+func newStudioZip(t *testing.T, files map[string]string) *bytes.Reader {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestParseIOReader(t *testing.T) {
+	r := newStudioZip(t, map[string]string{
+		StudioModelName:                       "0 FILE model.ldr\n1 4 0 0 0 1 0 0 0 1 0 0 0 1 MyCustom.dat\n1 4 0 0 0 1 0 0 0 1 0 0 0 1 mycustom.dat\n",
+		"CustomParts/parts/MyCustom.dat":      "0 My Custom\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 s\\mycustoms01.dat\n",
+		"CustomParts/parts/s/mycustoms01.dat": "0 ~My Custom side\n4 16 -10 0 -10 10 0 -10 10 8 10 -10 8 10\n",
+	})
+
+	mainFile := NewRawFile()
+	if err := ParseIOReader(r, r.Size(), "test.io", mainFile, nil); err != nil {
+		t.Fatal(err)
+	}
+	if p := mainFile.Parts["mycustom.dat-4"]; p == nil || p.Count != 2 {
+		t.Errorf("wrong parts: %v", mainFile.Parts)
+	}
+	if bb, ok := mainFile.CustomParts["mycustom.dat"]; !ok || bb != [2][3]float64{{-10, 0, -10}, {10, 8, 10}} {
+		t.Errorf("wrong custom parts: %v", mainFile.CustomParts)
+	}
+}
+
+func TestParseIOReaderBrokenCustomPart(t *testing.T) {
+	files := map[string]string{
+		StudioModelName:                  "0 FILE model.ldr\n1 4 0 0 0 1 0 0 0 1 0 0 0 1 mycustom.dat\n",
+		"CustomParts/parts/mycustom.dat": "0 My Custom\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 s\\missing.dat\n",
+	}
+
+	r := newStudioZip(t, files)
+	if err := ParseIOReader(r, r.Size(), "test.io", NewRawFile(), nil); !errors.Is(err, ErrSubFileNotFound) {
+		t.Fatalf("want ErrSubFileNotFound, got %v", err)
+	}
+
+	r = newStudioZip(t, files)
+	mainFile := NewRawFile()
+	mainFile.Report = &Report{}
+	if err := ParseIOReader(r, r.Size(), "test.io", mainFile, nil); err != nil {
+		t.Fatal(err)
+	}
+	if p := mainFile.Parts["mycustom.dat-4"]; p == nil || p.Count != 1 {
+		t.Errorf("wrong parts: %v", mainFile.Parts)
+	}
+	if problems := mainFile.Report.Problems(); len(problems) != 1 || problems[0].Kind != ProblemMissing {
+		t.Errorf("wrong problems: %v", problems)
+	}
+}
+
+// encryptedIO studio .io file made by `zip -P soho0909`, model.ldr and custom
+// part are deflated, side of custom part is stored by `zip -0`
+const encryptedIO = `
+UEsDBBQACQAIAOUyUl3yAOf+ZgAAAM0AAAAJABwAbW9kZWwubGRyVVQJAAPNZdRqzWXUanV4CwAB
+BAAAAAAEAAAAAF9MyOAu0W6eiJb5puT3Cgf6EWj2EkpqkhkmSFEvMFHcEfsgq3UzT9E0Cm3fUReF
+2oCV64VneyJpr+wWEfkog4041VSXVRti5jhLLtMd5u1NBHXuRzWmw7HyNsHeD8DqxW9klPT7OVBL
+BwjyAOf+ZgAAAM0AAABQSwMEFAAJAAgA5TJSXQ5XTzhAAAAAUAAAAB4AHABDdXN0b21QYXJ0cy9w
+YXJ0cy9NeUN1c3RvbS5kYXRVVAkAA81l1GrNZdRqdXgLAAEEAAAAAAQAAAAAozEpKSAw3/7aiHlj
+/lxJ8Snvq9k4LQIeH5PX6aSzeN/NJM5a/yalfniKJwPDI37Gqz+Rv6fy7rEVsR3X74a0h1BLBwgO
+V084QAAAAFAAAABQSwMECgAJAAAA5TJSXX35PMRHAAAAOwAAACMAHABDdXN0b21QYXJ0cy9wYXJ0
+cy9zL215Y3VzdG9tczAxLmRhdFVUCQADzWXUas1l1Gp1eAsAAQQAAAAABAAAAACxgbvBZNTZDVOm
+FzOIvy0SumhIpbz5HbOWC3RqPad4J/jBwa8Ap5EEVDaZE+wrJ9RrztKWHyLeDQPSaSDRXR6wWC7e
+yFrfclBLBwh9+TzERwAAADsAAABQSwECHgMUAAkACADlMlJd8gDn/mYAAADNAAAACQAYAAAAAAAB
+AAAApIEAAAAAbW9kZWwubGRyVVQFAAPNZdRqdXgLAAEEAAAAAAQAAAAAUEsBAh4DFAAJAAgA5TJS
+XQ5XTzhAAAAAUAAAAB4AGAAAAAAAAQAAAKSBuQAAAEN1c3RvbVBhcnRzL3BhcnRzL015Q3VzdG9t
+LmRhdFVUBQADzWXUanV4CwABBAAAAAAEAAAAAFBLAQIeAwoACQAAAOUyUl19+TzERwAAADsAAAAj
+ABgAAAAAAAAAAACkgWEBAABDdXN0b21QYXJ0cy9wYXJ0cy9zL215Y3VzdG9tczAxLmRhdFVUBQAD
+zWXUanV4CwABBAAAAAAEAAAAAFBLBQYAAAAAAwADABwBAAAVAgAAAAA=`
+
+func TestZipCrypto(t *testing.T) {
+	data, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(encryptedIO, "\n", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(data)
+
+	zr, err := zip.NewReader(r, r.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range zr.File {
+		if f.Flags&0x1 == 0 {
+			t.Fatalf("%s not encrypted", f.Name)
+		}
+		if _, err := readZipEntry(r, f, "soho0908"); !errors.Is(err, ErrBadPassword) {
+			t.Errorf("%s: want ErrBadPassword, got %v", f.Name, err)
+		}
+	}
+
+	mainFile := NewRawFile()
+	if err := ParseIOReader(r, r.Size(), "encrypted.io", mainFile, nil); err != nil {
+		t.Fatal(err)
+	}
+	if p := mainFile.Parts["mycustom.dat-14"]; p == nil || p.Count != 2 {
+		t.Errorf("wrong parts: %v", mainFile.Parts)
+	}
+	if p := mainFile.Parts["3001-1"]; p == nil || p.Count != 1 {
+		t.Errorf("wrong parts: %v", mainFile.Parts)
+	}
+	if bb, ok := mainFile.CustomParts["mycustom.dat"]; !ok || bb != [2][3]float64{{-10, 0, -10}, {10, 8, 10}} {
+		t.Errorf("wrong custom parts: %v", mainFile.CustomParts)
+	}
+}
@@ -0,0 +1,184 @@
+package ldraw
+
+import (
+	"fmt"
+	"io/fs"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Finding kinds of Validate
+const (
+	FindingUnknownPart    = "unknown-part"    // part not in library, model or custom parts
+	FindingSingularMatrix = "singular-matrix" // matrix of type 1 line can not be inverted
+	FindingNotOrthonormal = "non-orthonormal" // matrix of type 1 line scales or shears
+	FindingMirrored       = "mirrored-part"   // matrix of type 1 line mirrors part
+	FindingPrimitive      = "primitive-ref"   // model references ldraw p(sub) file
+	FindingDuplicate      = "duplicate-part"  // part placed on top of identical part
+	FindingUnusedFile     = "unused-file"     // mpd sub file not placed by main model
+	FindingUnknownColor   = "unknown-color"   // color code not in color table
+)
+
+// matrixTolerance tolerance of orthonormal matrix check
+const matrixTolerance = 1e-3
+
+// Finding one problem of model found by Validate
+type Finding struct {
+	Kind    string `json:"kind"`
+	File    string `json:"file"` // file or mpd sub file name
+	Line    int    `json:"line"` // 0 if not line related
+	Text    string `json:"text,omitempty"`
+	Message string `json:"message"`
+}
+
+func (f *Finding) String() string {
+	if f.Line == 0 {
+		return fmt.Sprintf("%s: %s: %s", f.File, f.Kind, f.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s: %s", f.File, f.Line, f.Kind, f.Message)
+}
+
+// Validate find problems of parsed model, nothing is changed. Colors are
+// checked against colors with local `0 !COLOUR` overlay, skipped if colors is
+// nil. Parts not in parts list are searched in ldraw library lib, can be nil.
+// Findings are sorted by file, main file first, then by line.
+func Validate(rawFile *RawFile, colors *ColorTable, lib fs.FS) []*Finding {
+	resp := []*Finding{}
+	files := []*RawFile{rawFile}
+	for _, name := range rawFile.SubFileOrder {
+		if sub, ok := rawFile.SubFiles[name]; ok {
+			files = append(files, sub)
+		}
+	}
+
+	info := rawFile.partInfo()
+	for _, rf := range files {
+		var fileColors *ColorTable
+		if colors != nil {
+			fileColors = rawFile.Colors.Overlay(colors)
+			if rf != rawFile {
+				fileColors = rf.Colors.Overlay(fileColors)
+			}
+		}
+
+		placed := map[string]*SubfileRef{}
+		for _, one := range rf.Lines {
+			ref, ok := one.(*SubfileRef)
+			if !ok {
+				continue
+			}
+			add := func(kind, format string, args ...interface{}) {
+				resp = append(resp, &Finding{Kind: kind, File: rf.Name, Line: ref.Num, Text: ref.Raw, Message: fmt.Sprintf(format, args...)})
+			}
+			name := strings.ToLower(strings.ReplaceAll(ref.Name, "\\", "/"))
+
+			if _, ok := info.P[name]; ok {
+				add(FindingPrimitive, "primitive %s placed in model", ref.Name)
+			} else if !isKnownPart(rawFile, info, lib, name) {
+				add(FindingUnknownPart, "part %s not found", ref.Name)
+			}
+
+			m := ref.TransMatrix()
+			switch det := m.Determinant(); {
+			case math.Abs(det) < 1e-9:
+				add(FindingSingularMatrix, "matrix of %s is singular", ref.Name)
+			case !m.IsOrthonormal(matrixTolerance):
+				add(FindingNotOrthonormal, "matrix of %s scales or shears it", ref.Name)
+			case det < 0:
+				add(FindingMirrored, "%s is mirrored", ref.Name)
+			}
+
+			if fileColors != nil && ref.Color != MainColor && ref.Color != EdgeColor {
+				if _, ok := fileColors.Lookup(ref.Color); !ok {
+					add(FindingUnknownColor, "color %s of %s not defined", formatColor(ref.Color), ref.Name)
+				}
+			}
+
+			k := name + " " + formatFloats(ref.Pos[:]...) + " " + formatFloats(ref.Matrix[:]...)
+			if first, ok := placed[k]; ok {
+				add(FindingDuplicate, "%s placed on top of identical part at line %d", ref.Name, first.Num)
+			} else {
+				placed[k] = ref
+			}
+		}
+	}
+
+	for _, name := range unusedSubFiles(rawFile) {
+		sub := rawFile.SubFiles[name]
+		one := &Finding{Kind: FindingUnusedFile, File: name, Message: fmt.Sprintf("sub file %s is not placed in model", name)}
+		if len(sub.Lines) > 0 {
+			one.Line, one.Text = sub.Lines[0].LineNum(), sub.Lines[0].LineText()
+		}
+		resp = append(resp, one)
+	}
+
+	// main file first, sub files in file order, unused files with their
+	// first line
+	order := map[string]int{rawFile.Name: 0}
+	for i, name := range rawFile.SubFileOrder {
+		order[name] = i + 1
+	}
+	sort.SliceStable(resp, func(i, j int) bool {
+		oi, oki := order[resp[i].File]
+		oj, okj := order[resp[j].File]
+		switch {
+		case oki != okj:
+			return oki
+		case oi != oj:
+			return oi < oj
+		case resp[i].File != resp[j].File:
+			return resp[i].File < resp[j].File
+		}
+		return resp[i].Line < resp[j].Line
+	})
+	return resp
+}
+
+// isKnownPart part is in parts list, mpd sub files, custom parts or library
+func isKnownPart(rawFile *RawFile, info *LdrInfo, lib fs.FS, name string) bool {
+	if _, ok := info.Parts[name]; ok {
+		return true
+	}
+	if _, ok := rawFile.SubFiles[name]; ok || name == rawFile.Name {
+		return true
+	}
+	if _, ok := rawFile.CustomParts[name]; ok {
+		return true
+	}
+	if lib != nil {
+		if _, err := findSubFileFS(lib, name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// unusedSubFiles names of sub files not reached from main file, in file order
+func unusedSubFiles(rawFile *RawFile) []string {
+	used := map[string]bool{}
+	queue := []*RawFile{rawFile}
+	for len(queue) > 0 {
+		rf := queue[0]
+		queue = queue[1:]
+		for _, one := range rf.Lines {
+			ref, ok := one.(*SubfileRef)
+			if !ok {
+				continue
+			}
+			name := strings.ToLower(ref.Name)
+			if sub, ok := rawFile.SubFiles[name]; ok && !used[name] {
+				used[name] = true
+				queue = append(queue, sub)
+			}
+		}
+	}
+
+	resp := []string{}
+	for _, name := range rawFile.SubFileOrder {
+		if _, ok := rawFile.SubFiles[name]; ok && !used[name] {
+			resp = append(resp, name)
+		}
+	}
+	return resp
+}
@@ -0,0 +1,93 @@
+package ldraw
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	parser := NewParser(&LdrInfo{
+		P:     map[string]struct{}{"stud.dat": {}},
+		Parts: map[string][2][3]float64{"3001.dat": {}, "3003.dat": {}},
+	}, nil)
+
+	content := "0 FILE main.ldr\n" +
+		"1 4 0 0 0 1 0 0 0 1 0 0 0 1 3001.dat\n" + // 2 fine
+		"1 4 0 0 0 1 0 0 0 1 0 0 0 1 3001.dat\n" + // 3 on top of line 2
+		"1 4 0 -24 0 -1 0 0 0 1 0 0 0 1 3001.dat\n" + // 4 mirrored
+		"1 4 0 -48 0 2 0 0 0 1 0 0 0 1 3001.dat\n" + // 5 scaled
+		"1 4 0 -72 0 0 0 0 0 1 0 0 0 1 3001.dat\n" + // 6 singular
+		"1 4 0 0 0 1 0 0 0 1 0 0 0 1 stud.dat\n" + // 7 primitive
+		"1 999 40 0 0 1 0 0 0 1 0 0 0 1 3003.dat\n" + // 8 unknown color
+		"1 4 80 0 0 1 0 0 0 1 0 0 0 1 mypart.dat\n" + // 9 found in library
+		"1 4 0 0 0 1 0 0 0 1 0 0 0 1 notapart.dat\n" + // 10 unknown
+		"1 0x2FF0000 0 0 80 1 0 0 0 1 0 0 0 1 sub.ldr\n" + // 11 direct color
+		"0 FILE sub.ldr\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 3003.dat\n" +
+		"0 FILE unused.ldr\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 3003.dat\n"
+	mainFile := NewRawFile()
+	if err := parser.ParseLdrReader(strings.NewReader(content), "main.mpd", mainFile); err != nil {
+		t.Fatal(err)
+	}
+
+	colors := NewColorTable()
+	colors.Add(&Color{Name: "Red", Code: 4})
+	lib := NewLibrary(fstest.MapFS{"parts/mypart.dat": {Data: []byte("0 my part\n")}})
+
+	want := []string{
+		"main.ldr:3: duplicate-part",
+		"main.ldr:4: mirrored-part",
+		"main.ldr:5: non-orthonormal",
+		"main.ldr:6: singular-matrix",
+		"main.ldr:7: primitive-ref",
+		"main.ldr:8: unknown-color",
+		"main.ldr:10: unknown-part",
+		"unused.ldr:14: unused-file",
+	}
+	got := Validate(mainFile, colors, lib)
+	if len(got) != len(want) {
+		t.Fatalf("want %d findings, got %v", len(want), got)
+	}
+	for i, finding := range got {
+		if !strings.HasPrefix(finding.String(), want[i]+": ") {
+			t.Errorf("want %s, got %s", want[i], finding)
+		}
+	}
+}
+
+func TestValidateFileOrder(t *testing.T) {
+	t.Parallel()
+	parser := NewParser(&LdrInfo{Parts: map[string][2][3]float64{"3001.dat": {}}}, nil)
+
+	// sub files read from other sources share line numbers with main file
+	mainFile := NewRawFile()
+	if err := parser.ParseLdrReader(strings.NewReader("0 Main\n1 4 0 0 0 1 0 0 0 1 0 0 0 1 b.ldr\n1 4 0 0 0 1 0 0 0 1 0 0 0 1 nota.dat\n"), "main.ldr", mainFile); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"b.ldr", "a.ldr"} {
+		sub := NewRawFile()
+		if err := parser.ParseLdrReader(strings.NewReader("0 Sub\n1 4 0 0 0 1 0 0 0 1 0 0 0 1 notb.dat\n"), name, sub); err != nil {
+			t.Fatal(err)
+		}
+		sub.Name = name
+		mainFile.SubFiles[name] = sub
+		mainFile.SubFileOrder = append(mainFile.SubFileOrder, name)
+	}
+
+	want := []string{
+		"main:3: unknown-part",
+		"b.ldr:2: unknown-part",
+		"a.ldr:1: unused-file",
+		"a.ldr:2: unknown-part",
+	}
+	got := Validate(mainFile, nil, nil)
+	if len(got) != len(want) {
+		t.Fatalf("want %d findings, got %v", len(want), got)
+	}
+	for i, finding := range got {
+		if !strings.HasPrefix(finding.String(), want[i]+": ") {
+			t.Errorf("want %s, got %s", want[i], finding)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package ldraw
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WriteTo write main file and all inline sub files back as ldr/mpd text.
+// Lines keep origin text, order and precision, raw lines are written back
+// unchanged, output is normalized to trimmed `\n` ended lines without empty
+// ones.
+func (rf *RawFile) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	var n int64
+
+	for _, lines := range rf.allLines() {
+		for _, l := range lines {
+			c, err := bw.WriteString(FormatLine(l) + "\n")
+			n += int64(c)
+			if err != nil {
+				return n, err
+			}
+		}
+	}
+
+	return n, bw.Flush()
+}
+
+// Save write raw file to fileName
+func (rf *RawFile) Save(fileName string) error {
+	wf, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+
+	if _, err := rf.WriteTo(wf); err != nil {
+		wf.Close()
+		return err
+	}
+	return wf.Close()
+}
+
+// allLines lines of main file, sub files and data files in file order,
+// unordered sub files are sorted by name at last
+func (rf *RawFile) allLines() [][]LdrLine {
+	resp := [][]LdrLine{rf.Lines}
+	seen := map[string]struct{}{}
+	for _, name := range rf.SubFileOrder {
+		if sub, ok := rf.SubFiles[name]; ok {
+			resp = append(resp, sub.Lines)
+		} else if data, ok := rf.DataFiles[name]; ok {
+			resp = append(resp, data.Lines)
+		}
+		seen[name] = struct{}{}
+	}
+
+	rest := []string{}
+	for name := range rf.SubFiles {
+		if _, ok := seen[name]; !ok {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	for _, name := range rest {
+		resp = append(resp, rf.SubFiles[name].Lines)
+	}
+	return resp
+}
+
+// FormatLine format typed line as ldraw text, origin text is used if exists
+func FormatLine(l LdrLine) string {
+	if raw := l.LineText(); raw != "" {
+		return raw
+	}
+
+	switch v := l.(type) {
+	case *Comment:
+		if v.Text == "" {
+			return "0"
+		}
+		return "0 // " + v.Text
+	case *Meta:
+		if v.Text != "" {
+			return "0 " + v.Text
+		}
+		return strings.Join(append([]string{"0", v.Command}, v.Args...), " ")
+	case *SubfileRef:
+		return "1 " + formatColor(v.Color) + " " + formatFloats(v.Pos[:]...) + " " + formatFloats(v.Matrix[:]...) + " " + v.Name
+	case *Line:
+		return "2 " + formatColor(v.Color) + " " + formatVectors(v.Points[:]...)
+	case *Triangle:
+		return "3 " + formatColor(v.Color) + " " + formatVectors(v.Points[:]...)
+	case *Quad:
+		return "4 " + formatColor(v.Color) + " " + formatVectors(v.Points[:]...)
+	case *OptionalLine:
+		return "5 " + formatColor(v.Color) + " " + formatVectors(v.Points[:]...) + " " + formatVectors(v.Controls[:]...)
+	}
+	return ""
+}
+
+// formatColor direct colors are written as hex
+func formatColor(c int) string {
+	if c >= 0x2000000 {
+		return "0x" + strings.ToUpper(strconv.FormatInt(int64(c), 16))
+	}
+	return strconv.Itoa(c)
+}
+
+// formatFloats shortest text keeps full precision
+func formatFloats(fs ...float64) string {
+	ss := make([]string, len(fs))
+	for i, f := range fs {
+		if f == 0 {
+			f = 0 // no `-0`
+		}
+		ss[i] = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return strings.Join(ss, " ")
+}
+
+func formatVectors(vs ...TransVector) string {
+	ss := make([]string, len(vs))
+	for i, v := range vs {
+		ss[i] = formatFloats(v[:]...)
+	}
+	return strings.Join(ss, " ")
+}
@@ -0,0 +1,78 @@
+package ldraw
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRawFileWriteTo(t *testing.T) {
+	content := "0 FILE main.ldr\n0 Main\n0 // keep me\n1 4 0 -24.000 0 1 0 0 0 1 0 0 0 1 sub.ldr\n0 NOFILE\n" +
+		"0 FILE sub.ldr\n0 Sub\n1 16 0.0001 0 0 1 0 0 0 1 0 0 0 1 3001.dat\n2 24 0 0 0 1 1 1\n0 NOFILE\n"
+	mainFile := NewRawFile()
+	if err := ParseLdrReader(strings.NewReader(strings.ReplaceAll(content, "\n", "\r\n")), "main.ldr", mainFile); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := mainFile.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != content {
+		t.Errorf("round trip not match:\n%s", buf.String())
+	}
+}
+
+func TestRawFileWriteToRawLines(t *testing.T) {
+	content := "0 FILE main.ldr\n0 Main\n7 16 unknown type\n1 16 0 0 0 1 0 0\n1 4 0 0 0 1 0 0 0 1 0 0 0 1 sub.ldr\n0 NOFILE\n" +
+		"0 FILE sub.ldr\n0 Sub\n3 16 0 0 0 1 0 0\n1 16 0 0 0 1 0 0 0 1 0 0 0 1 3001.dat\n0 NOFILE\n"
+
+	// skipped lines in strict mode, also broken lines in tolerant mode
+	for _, report := range []*Report{nil, {}} {
+		mainFile := NewRawFile()
+		mainFile.Report = report
+		err := ParseLdrReader(strings.NewReader(content), "main.ldr", mainFile)
+		if report == nil {
+			if !errors.Is(err, ErrBadLine) {
+				t.Errorf("want ErrBadLine, got %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p := mainFile.Parts["sub.ldr-4"]; p == nil || p.Count != 1 {
+			t.Errorf("wrong parts: %v", mainFile.Parts)
+		}
+
+		buf := &bytes.Buffer{}
+		if _, err := mainFile.WriteTo(buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != content {
+			t.Errorf("round trip not match:\n%s", buf.String())
+		}
+	}
+
+	// skipped lines only
+	content = strings.Replace(content, "3 16 0 0 0 1 0 0\n", "", 1)
+	mainFile := NewRawFile()
+	if err := ParseLdrReader(strings.NewReader(content), "main.ldr", mainFile); err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if _, err := mainFile.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != content {
+		t.Errorf("round trip not match:\n%s", buf.String())
+	}
+}
+
+func TestFormatLine(t *testing.T) {
+	ref := &SubfileRef{Color: 0x2FF0000, Pos: TransVector{0, -24, 0.5}, Matrix: [9]float64{1, 0, 0, 0, 1, 0, 0, 0, 1}, Name: "3001.dat"}
+	if got, want := FormatLine(ref), "1 0x2FF0000 0 -24 0.5 1 0 0 0 1 0 0 0 1 3001.dat"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}